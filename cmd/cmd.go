@@ -17,6 +17,8 @@ var (
 	cfgFile string
 	// verbose is the verbosity level used in logrus.
 	verbose string
+	// cfgErr is the error reading the configuration file.
+	cfgErr error
 )
 
 // RootCmd represents the base command when called without any subcommands.
@@ -27,6 +29,13 @@ var RootCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		_ = cmd.Help()
 	},
+	PersistentPreRun: func(c *cobra.Command, args []string) {
+		if cfgErr != nil && c != configCheckCmd && c != configInitCmd && c.Name() != "help" {
+			fmt.Println("Failed to read config:", cfgErr)
+			fmt.Println("Run 'gipc config check' to check it, or 'gipc config init' to create it")
+			os.Exit(-1)
+		}
+	},
 }
 
 var syncLoopCmd = &cobra.Command{
@@ -84,6 +93,175 @@ var ipfscRmCmd = &cobra.Command{
 	Run:   cmd.IpfscRemove,
 }
 
+var whyCmd = &cobra.Command{
+	Use:   "why <hash>",
+	Short: "Show why a hash is pinned",
+	Long:  "Show the roots, ENS paths and objects through which a hash is pinned",
+	Args:  cobra.ExactArgs(1),
+	Run:   cmd.Why,
+}
+
+var consortiumCmd = &cobra.Command{
+	Use:   "consortium",
+	Short: "Manage the consortium manifest",
+	Long:  "Manage the consortium manifest",
+	Run: func(cmd *cobra.Command, args []string) {
+		_ = cmd.Help()
+	},
+}
+
+var consortiumInitCmd = &cobra.Command{
+	Use:   "init [quotum]",
+	Short: "Initialize the consortium manifest",
+	Long:  "Initialize the consortium manifest",
+	Args:  cobra.MaximumNArgs(1),
+	Run:   cmd.ConsortiumInit,
+}
+
+var consortiumAddMemberCmd = &cobra.Command{
+	Use:   "add-member <ens> <quotum>",
+	Short: "Add member to the consortium",
+	Long:  "Add member to the consortium",
+	Args:  cobra.ExactArgs(2),
+	Run:   cmd.ConsortiumAddMember,
+}
+
+var consortiumRmMemberCmd = &cobra.Command{
+	Use:   "rm-member <ens>...",
+	Short: "Remove members from the consortium",
+	Long:  "Remove members from the consortium",
+	Args:  cobra.MinimumNArgs(1),
+	Run:   cmd.ConsortiumRemoveMember,
+}
+
+var consortiumSetQuotumCmd = &cobra.Command{
+	Use:   "set-quotum [ens] <quotum>",
+	Short: "Set the quotum of the consortium or a member",
+	Long:  "Set the quotum of the consortium or, if specified, a member",
+	Args:  cobra.RangeArgs(1, 2),
+	Run:   cmd.ConsortiumSetQuotum,
+}
+
+var consortiumLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "Info of local consortium",
+	Long:  "Info of local consortium",
+	Run:   cmd.ConsortiumLs,
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Check and create the config file",
+	Long:  "Check and create the config file",
+	Run: func(cmd *cobra.Command, args []string) {
+		_ = cmd.Help()
+	},
+}
+
+var configCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check the config file",
+	Long:  "Check all the fields of the config file, and that the keystore has the account",
+	Args:  cobra.NoArgs,
+	Run:   cmd.ConfigCheck,
+}
+
+var configInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Create a config file",
+	Long:  "Create a commented config file, asking the values not given by flags if run in a terminal",
+	Args:  cobra.NoArgs,
+	Run:   cmd.ConfigInit,
+}
+
+var accountCmd = &cobra.Command{
+	Use:   "account",
+	Short: "Manage the keystore accounts",
+	Long:  "Manage the accounts of the keystore in keystore.path",
+	Run: func(cmd *cobra.Command, args []string) {
+		_ = cmd.Help()
+	},
+}
+
+var accountNewCmd = &cobra.Command{
+	Use:   "new",
+	Short: "Create a new account",
+	Long:  "Create a new account in the keystore",
+	Args:  cobra.NoArgs,
+	Run:   cmd.AccountNew,
+}
+
+var accountImportCmd = &cobra.Command{
+	Use:   "import <privkey-file>",
+	Short: "Import a private key",
+	Long:  "Import to the keystore a private key, stored in hex in a file",
+	Args:  cobra.ExactArgs(1),
+	Run:   cmd.AccountImport,
+}
+
+var accountListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the accounts",
+	Long:  "List the accounts of the keystore, the configured one is marked with *",
+	Args:  cobra.NoArgs,
+	Run:   cmd.AccountList,
+}
+
+var accountBalanceCmd = &cobra.Command{
+	Use:   "balance [address]",
+	Short: "Show the balance of the account",
+	Long:  "Show the balance of the configured account, or the specified one, in every configured network",
+	Args:  cobra.MaximumNArgs(1),
+	Run:   cmd.AccountBalance,
+}
+
+var accountNonceCmd = &cobra.Command{
+	Use:   "nonce [address]",
+	Short: "Show the nonce of the account",
+	Long:  "Show the nonce of the configured account, or the specified one, in every configured network",
+	Args:  cobra.MaximumNArgs(1),
+	Run:   cmd.AccountNonce,
+}
+
+var savepointCmd = &cobra.Command{
+	Use:   "savepoint",
+	Short: "Manage the event scanner savepoint",
+	Long:  "Manage the event scanner savepoint",
+	Run: func(cmd *cobra.Command, args []string) {
+		_ = cmd.Help()
+	},
+}
+
+var savepointShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the savepoint",
+	Long:  "Show the savepoint and the skipped transactions",
+	Run:   cmd.SavePointShow,
+}
+
+var savepointResetCmd = &cobra.Command{
+	Use:   "reset",
+	Short: "Reset the savepoint",
+	Long:  "Reset the savepoint, scanning will start at the last block",
+	Run:   cmd.SavePointReset,
+}
+
+var savepointSetCmd = &cobra.Command{
+	Use:   "set <block>",
+	Short: "Move the savepoint to a block",
+	Long:  "Move the savepoint, scanning will start at the beginning of the block",
+	Args:  cobra.ExactArgs(1),
+	Run:   cmd.SavePointSet,
+}
+
+var savepointSkipTxCmd = &cobra.Command{
+	Use:   "skip-tx <txid>...",
+	Short: "Skip transactions while scanning",
+	Long:  "Skip transactions while scanning",
+	Args:  cobra.MinimumNArgs(1),
+	Run:   cmd.SavePointSkipTx,
+}
+
 // ExecuteCmd adds all child commands to the root command sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func ExecuteCmd() {
@@ -102,7 +280,10 @@ func init() {
 	RootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file")
 	RootCmd.PersistentFlags().StringVar(&verbose, "verbose", "INFO", "verbose level")
 
+	syncLoopCmd.Flags().Bool("events", false, "sync on ENS events, with periodic full syncs")
 	RootCmd.AddCommand(syncLoopCmd)
+	syncOnceCmd.Flags().Bool("dry-run", false, "print what the sync would do, without pinning, unpinning or writing the db")
+	syncOnceCmd.Flags().Bool("json", false, "print the dry run as JSON")
 	RootCmd.AddCommand(syncOnceCmd)
 
 	RootCmd.AddCommand(dbDumpCmd)
@@ -113,6 +294,39 @@ func init() {
 	RootCmd.AddCommand(ipfscAddCmd)
 	RootCmd.AddCommand(ipfscRmCmd)
 
+	whyCmd.Flags().Bool("json", false, "print as JSON")
+	RootCmd.AddCommand(whyCmd)
+
+	consortiumInitCmd.Flags().Bool("force", false, "overwrite existing manifest")
+	consortiumAddMemberCmd.Flags().Bool("force", false, "overwrite pinning manifest")
+	consortiumCmd.AddCommand(consortiumInitCmd)
+	consortiumCmd.AddCommand(consortiumAddMemberCmd)
+	consortiumCmd.AddCommand(consortiumRmMemberCmd)
+	consortiumCmd.AddCommand(consortiumSetQuotumCmd)
+	consortiumCmd.AddCommand(consortiumLsCmd)
+	RootCmd.AddCommand(consortiumCmd)
+
+	cmd.ConfigFlags(configInitCmd)
+	configInitCmd.Flags().String("output", "gipc.yaml", "config file to write")
+	configInitCmd.Flags().Bool("force", false, "overwrite an existing config file")
+	configCmd.AddCommand(configCheckCmd)
+	configCmd.AddCommand(configInitCmd)
+	RootCmd.AddCommand(configCmd)
+
+	accountCmd.AddCommand(accountNewCmd)
+	accountCmd.AddCommand(accountImportCmd)
+	accountCmd.AddCommand(accountListCmd)
+	accountCmd.AddCommand(accountBalanceCmd)
+	accountCmd.AddCommand(accountNonceCmd)
+	RootCmd.AddCommand(accountCmd)
+
+	savepointSkipTxCmd.Flags().Bool("remove", false, "stop skipping the transactions")
+	savepointCmd.AddCommand(savepointShowCmd)
+	savepointCmd.AddCommand(savepointResetCmd)
+	savepointCmd.AddCommand(savepointSetCmd)
+	savepointCmd.AddCommand(savepointSkipTxCmd)
+	RootCmd.AddCommand(savepointCmd)
+
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -136,13 +350,14 @@ func initConfig() {
 	}
 
 	if err := viper.ReadInConfig(); err != nil {
-		panic(err)
+		cfgErr = err
+		return
 	}
 
 	log.WithField("file", viper.ConfigFileUsed()).Debug("Using config file")
 
 	if err := viper.Unmarshal(&cfg.C); err != nil {
-		panic(err)
+		cfgErr = err
 	}
 
 }
@@ -0,0 +1,129 @@
+package commands
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	cfg "github.com/ipfsconsortium/go-ipfsc/config"
+	eth "github.com/ipfsconsortium/go-ipfsc/eth"
+	"github.com/spf13/cobra"
+)
+
+// openKeystore opens the keystore of the config.
+func openKeystore() *keystore.KeyStore {
+	if cfg.C.Keystore.Path == "" {
+		must(fmt.Errorf("keystore.path is not set"))
+	}
+	return keystore.NewKeyStore(cfg.C.Keystore.Path, keystore.StandardScryptN, keystore.StandardScryptP)
+}
+
+// AccountNew command
+func AccountNew(cmd *cobra.Command, args []string) {
+
+	ks := openKeystore()
+	passwd, err := newKeystorePasswd()
+	must(err)
+
+	account, err := ks.NewAccount(passwd)
+	must(err)
+
+	fmt.Printf("Account %v created in %v\n", account.Address.Hex(), account.URL.Path)
+	fmt.Println("Set it as keystore.account in the config to use it")
+}
+
+// AccountImport command
+func AccountImport(cmd *cobra.Command, args []string) {
+
+	key, err := crypto.LoadECDSA(args[0])
+	must(err)
+
+	ks := openKeystore()
+	passwd, err := newKeystorePasswd()
+	must(err)
+
+	account, err := ks.ImportECDSA(key, passwd)
+	must(err)
+
+	fmt.Printf("Account %v imported in %v\n", account.Address.Hex(), account.URL.Path)
+}
+
+// AccountList command
+func AccountList(cmd *cobra.Command, args []string) {
+
+	configured := common.HexToAddress(cfg.C.Keystore.Account)
+	for _, account := range openKeystore().Accounts() {
+		mark := " "
+		if account.Address == configured {
+			mark = "*"
+		}
+		fmt.Printf("%v %v %v\n", mark, account.Address.Hex(), account.URL.Path)
+	}
+}
+
+// AccountBalance command
+func AccountBalance(cmd *cobra.Command, args []string) {
+
+	forEachNetwork(args, func(networkid uint64, web3 *eth.Web3Client) error {
+		balance, err := web3.BalanceInfo()
+		if err != nil {
+			return err
+		}
+		wei, _ := new(big.Float).SetString(balance)
+		ether := new(big.Float).Quo(wei, big.NewFloat(1e18))
+		fmt.Printf("network %v: %v wei (%v ether)\n", networkid, balance, ether.Text('f', 6))
+		return nil
+	})
+}
+
+// AccountNonce command
+func AccountNonce(cmd *cobra.Command, args []string) {
+
+	forEachNetwork(args, func(networkid uint64, web3 *eth.Web3Client) error {
+		nonce, pending, err := web3.NonceInfo()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("network %v: nonce %v (pending %v)\n", networkid, nonce, pending)
+		return nil
+	})
+}
+
+// forEachNetwork runs info for the account in args, or the configured one,
+// in every configured network. A network that cannot be reached is reported
+// and the others are still queried.
+func forEachNetwork(args []string, info func(networkid uint64, web3 *eth.Web3Client) error) {
+
+	address := cfg.C.Keystore.Account
+	if len(args) > 0 {
+		address = args[0]
+	}
+	if !common.IsHexAddress(address) {
+		must(fmt.Errorf("Invalid account '%v'", address))
+	}
+	account := &accounts.Account{Address: common.HexToAddress(address)}
+
+	networkids := make([]uint64, 0, len(cfg.C.Networks))
+	for networkid := range cfg.C.Networks {
+		networkids = append(networkids, networkid)
+	}
+	sort.Slice(networkids, func(i, j int) bool { return networkids[i] < networkids[j] })
+
+	fmt.Printf("Account %v\n", account.Address.Hex())
+	for _, networkid := range networkids {
+		client, err := loadEthClient(networkid, cfg.C.Networks[networkid].RPCURL)
+		if err != nil {
+			fmt.Printf("network %v: %v\n", networkid, err)
+			continue
+		}
+		web3 := eth.NewWeb3Client(client, nil, account)
+		if err := info(networkid, web3); err != nil {
+			fmt.Printf("network %v: %v\n", networkid, err)
+		}
+		client.Close()
+	}
+}
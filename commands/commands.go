@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	cfg "github.com/ipfsconsortium/go-ipfsc/config"
 	"github.com/ipfsconsortium/go-ipfsc/service"
@@ -56,6 +57,18 @@ func IpfscLs(cmd *cobra.Command, args []string) {
 	for _, ipfshash := range pinningManifest.Pin {
 		info += "\nPin: " + ipfshash
 	}
+
+	err = storage.HashUpdateIter(func(hash string, entry *sto.HashEntry) *sto.HashEntry {
+		if !entry.Dirty && entry.MissedSyncs > 0 {
+			info += fmt.Sprintf("\nPending removal: %v (missed %v syncs since %v)",
+				hash, entry.MissedSyncs, time.Unix(int64(entry.MissedSince), 0).UTC().Format(time.RFC3339),
+			)
+		}
+		return nil
+	})
+	if err != nil {
+		log.WithError(err).Error("Failed to read pending removals")
+	}
 	fmt.Println(info)
 }
 
@@ -146,23 +159,108 @@ func IpfscRemove(cmd *cobra.Command, args []string) {
 	log.Info("Manifest sucessfully updated")
 }
 
+func newService() *service.Service {
+	srv := service.NewService(ipfsc, storage)
+	must(configureService(srv))
+	return srv
+}
+
+// configureService sets the sync settings of the config to srv, or their
+// defaults if unset. If a setting is invalid srv is left unchanged.
+func configureService(srv *service.Service) error {
+	pinmode := cfg.C.Sync.PinMode
+	switch pinmode {
+	case "":
+		pinmode = service.PinDirect
+	case service.PinDirect, service.PinRecursive:
+	default:
+		return fmt.Errorf("Invalid sync pin mode '%v'", pinmode)
+	}
+	retrydelay := service.DefaultRetryDelay
+	if cfg.C.Sync.RetryDelay != "" {
+		delay, err := time.ParseDuration(cfg.C.Sync.RetryDelay)
+		if err != nil {
+			return err
+		}
+		retrydelay = delay
+	}
+	maxretrydelay := service.DefaultMaxRetryDelay
+	if cfg.C.Sync.MaxRetryDelay != "" {
+		delay, err := time.ParseDuration(cfg.C.Sync.MaxRetryDelay)
+		if err != nil {
+			return err
+		}
+		maxretrydelay = delay
+	}
+	var graceperiod time.Duration
+	if cfg.C.Sync.GracePeriod != "" {
+		period, err := time.ParseDuration(cfg.C.Sync.GracePeriod)
+		if err != nil {
+			return err
+		}
+		graceperiod = period
+	}
+
+	srv.MaxDepth = service.DefaultMaxDepth
+	if cfg.C.Sync.MaxDepth > 0 {
+		srv.MaxDepth = cfg.C.Sync.MaxDepth
+	}
+	srv.Workers = service.DefaultWorkers
+	if cfg.C.Sync.Workers > 0 {
+		srv.Workers = cfg.C.Sync.Workers
+	}
+	srv.PinMode = pinmode
+	srv.RetryDelay = retrydelay
+	srv.MaxRetryDelay = maxretrydelay
+	srv.MaxRetries = service.DefaultMaxRetries
+	if cfg.C.Sync.MaxRetries > 0 {
+		srv.MaxRetries = cfg.C.Sync.MaxRetries
+	}
+	srv.GraceSyncs = cfg.C.Sync.GraceSyncs
+	srv.GracePeriod = graceperiod
+	return nil
+}
+
 func SyncLoop(cmd *cobra.Command, args []string) {
 
 	must(load(false))
-	srv := service.NewService(ipfsc, storage)
+	defer storage.Close()
+	srv := newService()
 	go service.HttpServe(srv, cfg.C.API.Port)
 
-	for {
-		srv.Sync(cfg.C.EnsNames.Remotes)
+	ctx, trigger := handleSignals()
+	reloads := watchConfig()
+
+	if events, _ := cmd.Flags().GetBool("events"); events {
+		for syncLoopEvents(ctx, trigger, reloads, srv) {
+			log.Info("Restarting event scanner")
+		}
+		return
 	}
+
+	syncLoopPlain(ctx, trigger, reloads, srv)
 }
 
 func SyncOnce(cmd *cobra.Command, args []string) {
 
 	must(load(false))
+	defer storage.Close()
+
+	ctx, _ := handleSignals()
+
+	if dryrun, _ := cmd.Flags().GetBool("dry-run"); dryrun {
+		plan, err := newService().Plan(ctx, cfg.C.EnsNames.Remotes)
+		if plan == nil {
+			must(err)
+		}
+		if err != nil {
+			log.WithError(err).Warn("Sync plan is incomplete")
+		}
+		asJSON, _ := cmd.Flags().GetBool("json")
+		must(printPlan(os.Stdout, plan, asJSON))
+		return
+	}
 
-	service.NewService(
-		ipfsc, storage,
-	).Sync(cfg.C.EnsNames.Remotes)
+	logStats(newService().Sync(ctx, cfg.C.EnsNames.Remotes))
 
 }
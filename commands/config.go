@@ -0,0 +1,247 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	cfg "github.com/ipfsconsortium/go-ipfsc/config"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// configTemplate is the config file written by config init.
+const configTemplate = `# gipc config, see https://github.com/ipfsconsortium/go-ipfsc
+
+keystore:
+  # account to use
+  account: {{quote .account}}
+  # path to the keystore
+  path: {{quote .keystore}}
+  # where the password of the keystore is read from, one of:
+  #   passwdfile: <file with the password, only readable by you>
+  #   passwdenv: <environment variable with the password>
+  #   passwdcommand: <command that prints the password, e.g. pass show gipc>
+  # if none is set, the password is asked
+
+ensnames:
+  # network of the ENS names, 1 for mainnet
+  network: {{.network}}
+  # your ENS domain
+  local: {{quote .local}}
+  # ENS domains containing IPFS manifests, IPFS hashes or pin registries to sync
+  remotes:{{range .remotes}}
+    - {{quote .}}{{else}} []{{end}}
+
+db:
+  # where the local database is stored
+  path: {{quote .db}}
+
+ipfs:
+  # URL of the IPFS api
+  apiurl: {{quote .ipfsurl}}
+  # timeout of the IPFS connections
+  timeout: {{quote .ipfstimeout}}
+
+networks:
+  {{.network}}:
+    # max gas price to pay, in wei
+    maxgasprice: {{.maxgasprice}}
+    # URL of the web3 HTTP api
+    rpcurl: {{quote .rpcurl}}
+    # URL of the web3 websocket or IPC api, used to subscribe to events
+    wsurl: {{quote .wsurl}}
+    # where the ENS root is located
+    ensroot: {{quote .ensroot}}
+    # blocks on top of a block before processing its events, not used by
+    # the subscribe scan
+    confirmations: {{.confirmations}}
+
+api:
+  # port of the api web service
+  port: {{.port}}
+
+sync:
+  # time between full syncs
+  interval: {{quote .interval}}
+  # maximum random delay added to the interval
+  # jitter: 5m
+  # delay to retry a failed sync, doubled up to the interval
+  # backoff: 1m
+  # maximum nesting of ENS names
+  # maxdepth: 16
+  # maximum concurrent IPFS requests
+  # workers: 4
+  # direct (pin each object of a DAG) or recursive
+  # pinmode: direct
+  # delay to retry a hash that failed, doubled on each failure
+  # retrydelay: 1m
+  # maximum delay to retry a hash
+  # maxretrydelay: 24h
+  # consecutive failures after which a hash fails permanently
+  # maxretries: 10
+  # consecutive syncs or time a hash must be unused before it is unpinned,
+  # whatever is reached first, 0 is not used
+  # gracesyncs: 0
+  # graceperiod: 24h
+  # how events are scanned: logs, receipts or subscribe (needs wsurl)
+  # scan: logs
+`
+
+// configQuestion is a value of the config written by config init, taken from
+// its flag, asked or its default.
+type configQuestion struct {
+	flag   string
+	prompt string
+	value  string
+	number bool
+}
+
+var configQuestions = []configQuestion{
+	{flag: "account", prompt: "Account to use"},
+	{flag: "keystore", prompt: "Path to the keystore"},
+	{flag: "network", prompt: "Network id, 1 for mainnet", value: "1", number: true},
+	{flag: "local", prompt: "Your ENS domain"},
+	{flag: "remotes", prompt: "ENS domains to sync, comma separated"},
+	{flag: "db", prompt: "Path of the local database", value: "gipcdb"},
+	{flag: "ipfs-url", prompt: "URL of the IPFS api", value: "http://localhost:5001"},
+	{flag: "ipfs-timeout", prompt: "Timeout of the IPFS connections", value: "60s"},
+	{flag: "rpc-url", prompt: "URL of the web3 HTTP api", value: "http://localhost:8545"},
+	{flag: "ws-url", prompt: "URL of the web3 websocket api, optional"},
+	{flag: "ens-root", prompt: "Address of the ENS root", value: "0x314159265dd8dbb310642f98f50c066173c1259b"},
+	{flag: "confirmations", prompt: "Confirmations of the events", value: "12", number: true},
+	{flag: "max-gas-price", prompt: "Max gas price in wei", value: "4000000000", number: true},
+	{flag: "port", prompt: "Port of the api", value: "8991", number: true},
+	{flag: "interval", prompt: "Time between full syncs", value: "1h"},
+}
+
+// ConfigFlags adds the flags of config init.
+func ConfigFlags(cmd *cobra.Command) {
+	for _, q := range configQuestions {
+		cmd.Flags().String(q.flag, q.value, q.prompt)
+	}
+}
+
+// ConfigCheck command
+func ConfigCheck(cmd *cobra.Command, args []string) {
+
+	var errs []error
+	var c cfg.Config
+
+	if err := viper.ReadInConfig(); err != nil {
+		errs = append(errs, err)
+	} else if err := viper.UnmarshalExact(&c); err != nil {
+		errs = append(errs, err)
+	} else {
+		errs = append(c.Check(), checkKeystore(&c)...)
+		if c.Keystore.Passwd != "" {
+			fmt.Println("Warning: keystore.passwd is deprecated since it stores the password in plaintext")
+		}
+	}
+
+	if len(errs) == 0 {
+		fmt.Printf("Config %v is valid\n", viper.ConfigFileUsed())
+		return
+	}
+	for _, err := range errs {
+		fmt.Println(err)
+	}
+	fmt.Printf("Config %v has %v errors\n", viper.ConfigFileUsed(), len(errs))
+	os.Exit(1)
+}
+
+// checkKeystore checks that the keystore has the account.
+func checkKeystore(c *cfg.Config) []error {
+	if c.Keystore.Account == "" || c.Keystore.Path == "" || !common.IsHexAddress(c.Keystore.Account) {
+		return nil
+	}
+	if _, err := os.Stat(c.Keystore.Path); err != nil {
+		return []error{fmt.Errorf("keystore.path %v", err)}
+	}
+	if c.Keystore.PasswdFile != "" {
+		if _, err := readPasswdFile(c.Keystore.PasswdFile); err != nil {
+			return []error{fmt.Errorf("keystore.passwdfile %v", err)}
+		}
+	}
+	ks := keystore.NewKeyStore(c.Keystore.Path, keystore.LightScryptN, keystore.LightScryptP)
+	if !ks.HasAddress(common.HexToAddress(c.Keystore.Account)) {
+		return []error{fmt.Errorf("keystore.account %v is not in the keystore %v", c.Keystore.Account, c.Keystore.Path)}
+	}
+	return nil
+}
+
+// ConfigInit command
+func ConfigInit(cmd *cobra.Command, args []string) {
+
+	output, _ := cmd.Flags().GetString("output")
+	force, _ := cmd.Flags().GetBool("force")
+	if _, err := os.Stat(output); err == nil && !force {
+		must(fmt.Errorf("Config %v already exists, use --force to overwrite it", output))
+	}
+
+	interactive := isTerminal(os.Stdin)
+	reader := bufio.NewReader(os.Stdin)
+
+	values := make(map[string]interface{})
+	for _, q := range configQuestions {
+		value, _ := cmd.Flags().GetString(q.flag)
+		if interactive && !cmd.Flags().Changed(q.flag) {
+			fmt.Printf("%v [%v]: ", q.prompt, value)
+			answer, err := reader.ReadString('\n')
+			must(err)
+			if answer = strings.TrimSpace(answer); answer != "" {
+				value = answer
+			}
+		}
+		if q.number {
+			if _, err := strconv.ParseUint(value, 10, 64); err != nil {
+				must(fmt.Errorf("%v '%v' is not a number", q.flag, value))
+			}
+		}
+		values[strings.Replace(q.flag, "-", "", -1)] = value
+	}
+
+	var remotes []string
+	for _, remote := range strings.Split(values["remotes"].(string), ",") {
+		if remote = strings.TrimSpace(remote); remote != "" {
+			remotes = append(remotes, remote)
+		}
+	}
+	values["remotes"] = remotes
+
+	tmpl := template.Must(template.New("config").Funcs(template.FuncMap{
+		"quote": strconv.Quote,
+	}).Parse(configTemplate))
+	var buffer bytes.Buffer
+	must(tmpl.Execute(&buffer, values))
+
+	// check the config as it will be read
+	v := viper.New()
+	v.SetConfigType("yaml")
+	must(v.ReadConfig(bytes.NewReader(buffer.Bytes())))
+	var c cfg.Config
+	must(v.UnmarshalExact(&c))
+	errs := append(c.Check(), checkKeystore(&c)...)
+	if len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Println(err)
+		}
+		must(fmt.Errorf("Config not written, it has %v errors", len(errs)))
+	}
+
+	must(ioutil.WriteFile(output, buffer.Bytes(), 0600))
+	fmt.Printf("Config written to %v\n", output)
+}
+
+// isTerminal returns if f is a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,230 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	cfg "github.com/ipfsconsortium/go-ipfsc/config"
+	"github.com/ipfsconsortium/go-ipfsc/service"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	errPinningManifest  = errors.New("ENS name holds a pinning manifest, use --force to overwrite it")
+	errConsortiumExists = errors.New("ENS name holds a consortium manifest, use --force to overwrite it")
+	errMemberExists     = errors.New("member already exists")
+	errMemberNotExists  = errors.New("member does not exist")
+)
+
+// readConsortiumManifest reads the consortium manifest of the local ENS name.
+// If the name holds a pinning manifest, a new consortium manifest is only
+// returned when forced.
+func readConsortiumManifest(force bool) (*service.ConsortiumManifest, error) {
+
+	m, err := ipfsc.Read(cfg.C.EnsNames.Local)
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := m.(type) {
+
+	case *service.ConsortiumManifest:
+		return v, nil
+
+	case *service.PinningManifest:
+		if !force {
+			return nil, errPinningManifest
+		}
+		log.WithField("ens", cfg.C.EnsNames.Local).Warn("Overwriting pinning manifest")
+		return &service.ConsortiumManifest{Quotum: v.Quotum}, nil
+	}
+
+	return nil, fmt.Errorf("Unknown manifest type in %v", cfg.C.EnsNames.Local)
+}
+
+func writeConsortiumManifest(manifest *service.ConsortiumManifest) {
+
+	if err := ipfsc.WriteConsortiumManifest(cfg.C.EnsNames.Local, manifest); err != nil {
+		log.Error("Failed to write manifest ", err)
+		return
+	}
+	log.Info("Manifest sucessfully updated")
+}
+
+// ConsortiumInit command
+func ConsortiumInit(cmd *cobra.Command, args []string) {
+
+	must(load(true))
+
+	force, _ := cmd.Flags().GetBool("force")
+
+	var quotum string
+	if len(args) > 0 {
+		quotum = args[0]
+	}
+	if _, err := service.ParseQuotum(quotum); err != nil {
+		log.WithError(err).Error("Failed to init")
+		return
+	}
+
+	// without force, only an ENS name without manifest is initialized
+	if !force {
+		text, err := ipfsc.ENS().Text(context.Background(), cfg.C.EnsNames.Local, service.DefaultManifestKey)
+		if err != nil {
+			log.WithError(err).Error("Failed to init, cannot read the current manifest")
+			return
+		}
+		if text != "" {
+			m, err := ipfsc.Read(cfg.C.EnsNames.Local)
+			if err != nil {
+				log.WithError(err).Error("Failed to init, cannot read the current manifest, use --force to overwrite it")
+				return
+			}
+			if _, ok := m.(*service.PinningManifest); ok {
+				log.WithError(errPinningManifest).Error("Failed to init")
+				return
+			}
+			log.WithError(errConsortiumExists).Error("Failed to init")
+			return
+		}
+	}
+
+	var manifest service.ConsortiumManifest
+	manifest.Quotum = quotum
+
+	if err := ipfsc.WriteConsortiumManifest(cfg.C.EnsNames.Local, &manifest); err != nil {
+		log.Error("Failed to init ", err)
+		return
+	}
+	log.Info("Sucessfully initialized")
+}
+
+// ConsortiumAddMember command
+func ConsortiumAddMember(cmd *cobra.Command, args []string) {
+
+	must(load(true))
+
+	force, _ := cmd.Flags().GetBool("force")
+	ensname, quotum := args[0], args[1]
+
+	if _, err := service.ParseQuotum(quotum); err != nil {
+		log.WithError(err).Error("Failed to add member")
+		return
+	}
+
+	manifest, err := readConsortiumManifest(force)
+	if err != nil {
+		log.WithError(err).Error("Failed to read manifest")
+		return
+	}
+
+	for _, member := range manifest.Members {
+		if member.EnsName == ensname {
+			log.WithError(errMemberExists).Error("Failed to add member ", ensname)
+			return
+		}
+	}
+
+	log.WithField("member", ensname).Info("Appending member to manifest")
+	manifest.Members = append(manifest.Members, service.ConsortiumMember{
+		EnsName: ensname,
+		Quotum:  quotum,
+	})
+
+	writeConsortiumManifest(manifest)
+}
+
+// ConsortiumRemoveMember command
+func ConsortiumRemoveMember(cmd *cobra.Command, args []string) {
+
+	must(load(true))
+
+	manifest, err := readConsortiumManifest(false)
+	if err != nil {
+		log.WithError(err).Error("Failed to read manifest")
+		return
+	}
+
+	remove := make(map[string]bool)
+	for _, ensname := range args {
+		remove[ensname] = true
+	}
+
+	members := []service.ConsortiumMember{}
+	for _, member := range manifest.Members {
+		if remove[member.EnsName] {
+			log.WithField("member", member.EnsName).Info("Removing member from manifest")
+			delete(remove, member.EnsName)
+			continue
+		}
+		members = append(members, member)
+	}
+
+	for ensname := range remove {
+		log.WithError(errMemberNotExists).Error("Failed to remove member ", ensname)
+		return
+	}
+
+	manifest.Members = members
+	writeConsortiumManifest(manifest)
+}
+
+// ConsortiumSetQuotum command, sets the consortium quotum or, if a member is
+// specified, the member quotum.
+func ConsortiumSetQuotum(cmd *cobra.Command, args []string) {
+
+	must(load(true))
+
+	quotum := args[len(args)-1]
+	if _, err := service.ParseQuotum(quotum); err != nil {
+		log.WithError(err).Error("Failed to set quotum")
+		return
+	}
+
+	manifest, err := readConsortiumManifest(false)
+	if err != nil {
+		log.WithError(err).Error("Failed to read manifest")
+		return
+	}
+
+	if len(args) == 1 {
+		manifest.Quotum = quotum
+		writeConsortiumManifest(manifest)
+		return
+	}
+
+	for i := range manifest.Members {
+		if manifest.Members[i].EnsName == args[0] {
+			manifest.Members[i].Quotum = quotum
+			writeConsortiumManifest(manifest)
+			return
+		}
+	}
+	log.WithError(errMemberNotExists).Error("Failed to set quotum of ", args[0])
+}
+
+// ConsortiumLs command
+func ConsortiumLs(cmd *cobra.Command, args []string) {
+
+	must(load(false))
+
+	info, err := ipfsc.ENS().Info(cfg.C.EnsNames.Local)
+	if err != nil {
+		log.WithError(err).Error("Failed to get info")
+		return
+	}
+	manifest, err := readConsortiumManifest(false)
+	if err != nil {
+		log.WithError(err).Error("Failed to read manifest")
+		fmt.Println(info)
+		return
+	}
+	info += "\nQuotum: " + manifest.Quotum
+	for _, member := range manifest.Members {
+		info += "\nMember: " + member.EnsName + " " + member.Quotum
+	}
+	fmt.Println(info)
+}
@@ -0,0 +1,163 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	cfg "github.com/ipfsconsortium/go-ipfsc/config"
+	eth "github.com/ipfsconsortium/go-ipfsc/eth"
+	"github.com/ipfsconsortium/go-ipfsc/service"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultSyncInterval is the time between full syncs
+	defaultSyncInterval = time.Hour
+)
+
+func syncInterval() (time.Duration, error) {
+	if cfg.C.Sync.Interval == "" {
+		return defaultSyncInterval, nil
+	}
+	return time.ParseDuration(cfg.C.Sync.Interval)
+}
+
+func logStats(stats service.ServiceStats, err error) {
+	if err != nil {
+		log.WithError(err).Error("Sync failed")
+	}
+	log.WithFields(log.Fields{
+		"count":    stats.Count,
+		"pinned":   stats.Pinned,
+		"unpinned": stats.Unpinned,
+		"errors":   stats.Errors,
+		"deferred": stats.Deferred,
+		"degraded": len(stats.Degraded),
+	}).Info("Sync finished")
+	for _, degraded := range stats.Degraded {
+		log.WithFields(log.Fields{
+			"source":    degraded.Source,
+			"error":     degraded.Error,
+			"protected": degraded.Protected,
+			"blocking":  degraded.Blocking,
+		}).Warn("Degraded source")
+	}
+	for _, failed := range stats.PermanentFailures {
+		log.WithFields(log.Fields{
+			"hash":     failed.Hash,
+			"failures": failed.Failures,
+			"error":    failed.Error,
+			"next":     failed.NextRetry,
+		}).Warn("Permanently failing hash")
+	}
+}
+
+// syncLoopEvents syncs the ENS entries changed by TextChanged events, and
+// does a full sync every sync interval or when triggered, until ctx is
+// cancelled. The reloaded configs are applied between syncs, and it returns
+// true if the event scanner must be restarted to apply one, or because it
+// stopped.
+func syncLoopEvents(ctx context.Context, trigger <-chan struct{}, reloads <-chan cfg.Config, srv *service.Service) bool {
+
+	client := ethclients[cfg.C.EnsNames.Network]
+
+	// if there is no savepoint, start scanning at the last block
+	entry, err := storage.SavePointEntry()
+	must(err)
+	if entry == nil {
+		header, err := client.HeaderByNumber(context.Background(), nil)
+		must(err)
+		must(storage.MoveSavePoint(header.Number.Uint64()))
+	}
+
+	dispatcher := eth.NewScanEventDispatcher(client, storage.SavePoint())
+	dispatcher.ConfirmationDepth = cfg.C.Networks[cfg.C.EnsNames.Network].Confirmations
+	switch cfg.C.Sync.Scan {
+	case "", "logs":
+		dispatcher.Mode = eth.ScanLogs
+	case "receipts":
+		dispatcher.Mode = eth.ScanReceipts
+	case "subscribe":
+		dispatcher.Mode = eth.ScanSubscribe
+		dispatcher.SubscribeURL = cfg.C.Networks[cfg.C.EnsNames.Network].WSURL
+		if dispatcher.SubscribeURL == "" {
+			must(fmt.Errorf("Scan mode subscribe needs the network wsurl"))
+		}
+	default:
+		must(fmt.Errorf("Unknown scan mode '%v'", cfg.C.Sync.Scan))
+	}
+	watcher, err := service.NewWatcher(ipfsc.ENS(), dispatcher)
+	must(err)
+
+	updateWatcher := func() {
+		if err := watcher.Update(srv.Names()); err != nil {
+			log.WithError(err).Warn("Failed to update watched ENS names")
+		}
+	}
+
+	sched := newSchedule()
+	stats, err := srv.Sync(ctx, cfg.C.EnsNames.Remotes)
+	logStats(stats, err)
+	if ctx.Err() != nil {
+		return false
+	}
+	updateWatcher()
+
+	dispatcher.Start()
+	srv.SetScanner(dispatcher)
+	defer func() {
+		srv.SetScanner(nil)
+		dispatcher.Stop()
+		dispatcher.Join()
+	}()
+
+	timer := time.NewTimer(sched.next(stats, err))
+	defer timer.Stop()
+
+	fullSync := func() {
+		stats, err := srv.Sync(ctx, cfg.C.EnsNames.Remotes)
+		logStats(stats, err)
+		updateWatcher()
+		timer.Reset(sched.next(stats, err))
+	}
+
+	for {
+		select {
+
+		case <-ctx.Done():
+			return false
+
+		case <-dispatcher.Done():
+			log.WithField("status", dispatcher.Status()).Error("Event scanner stopped")
+			return true
+
+		case newcfg := <-reloads:
+			if applyConfig(srv, newcfg) {
+				return true
+			}
+			if err := sched.load(); err != nil {
+				log.WithError(err).Error("Invalid sync schedule, keeping the current one")
+			}
+
+		case <-watcher.Changed():
+			entries := watcher.Pending()
+			if len(entries) == 0 {
+				continue
+			}
+			logStats(srv.SyncNames(ctx, entries))
+			updateWatcher()
+
+		case <-trigger:
+			log.Info("Starting requested full sync")
+			if !timer.Stop() {
+				<-timer.C
+			}
+			fullSync()
+
+		case <-timer.C:
+			log.Info("Starting full sync")
+			fullSync()
+		}
+	}
+}
@@ -35,6 +35,10 @@ func load(withPrivateKey bool) error {
 
 	var err error
 
+	if err = cfg.C.Validate(); err != nil {
+		return err
+	}
+
 	if err = loadStorage(); err != nil {
 		return err
 	}
@@ -72,7 +76,11 @@ func loadIPFSC(withPrivateKey bool) (err error) {
 			return err
 		}
 
-		err = ks.Unlock(account, cfg.C.Keystore.Passwd)
+		var passwd string
+		if passwd, err = keystorePasswd(); err != nil {
+			return err
+		}
+		err = ks.Unlock(account, passwd)
 		if err != nil {
 			return err
 		}
@@ -81,7 +89,10 @@ func loadIPFSC(withPrivateKey bool) (err error) {
 
 	}
 
-	ensClient := ethclients[cfg.C.EnsNames.Network]
+	ensClient, ok := ethclients[cfg.C.EnsNames.Network]
+	if !ok {
+		return fmt.Errorf("Network %v of the ENS names is not defined", cfg.C.EnsNames.Network)
+	}
 	ensAddr := common.HexToAddress(cfg.C.Networks[cfg.C.EnsNames.Network].EnsRoot)
 
 	web3 := eth.NewWeb3Client(ensClient, ks, &account)
@@ -90,22 +101,28 @@ func loadIPFSC(withPrivateKey bool) (err error) {
 	if err != nil {
 		return err
 	}
+	registryclient, err := service.NewRegistryClient(web3)
+	if err != nil {
+		return err
+	}
 
 	log.WithField("url", cfg.C.IPFS.APIURL).Info("Checking IPFS.")
 
 	// load ipfs
 
 	ipfs := shell.NewShell(cfg.C.IPFS.APIURL)
-	duration, err := time.ParseDuration(cfg.C.IPFS.Timeout)
-	if err != err {
-		return err
+	if cfg.C.IPFS.Timeout != "" {
+		duration, err := time.ParseDuration(cfg.C.IPFS.Timeout)
+		if err != nil {
+			return fmt.Errorf("Invalid IPFS timeout '%v': %v", cfg.C.IPFS.Timeout, err)
+		}
+		ipfs.SetTimeout(duration)
 	}
-	ipfs.SetTimeout(duration)
 	if !ipfs.IsUp() {
 		return fmt.Errorf("Cannot connect with local IPFS node")
 	}
 
-	ipfsc = service.NewIPFSCClient(ipfs, ensclient)
+	ipfsc = service.NewIPFSCClient(ipfs, ensclient, registryclient)
 
 	return nil
 }
@@ -118,25 +135,39 @@ func loadEthClients() error {
 
 	for networkid, network := range cfg.C.Networks {
 
-		log.WithField("url", network.RPCURL).Info("Checking WEB3.")
-
-		client, err := ethclient.Dial(network.RPCURL)
+		client, err := loadEthClient(networkid, network.RPCURL)
 		if err != nil {
 			return err
 		}
 
-		clientnetworkid, err := client.NetworkID(context.Background())
-		if err != nil {
-			return err
-		}
-
-		if clientnetworkid.Uint64() != networkid {
-			return fmt.Errorf("NetworkID RPC return a different networkid", networkid)
-		}
-
 		ethclients[networkid] = client
 
 	}
 
 	return nil
 }
+
+// loadEthClient connects with the web3 endpoint of a network, and checks
+// that it serves that network.
+func loadEthClient(networkid uint64, rpcurl string) (*ethclient.Client, error) {
+
+	log.WithField("url", rpcurl).Info("Checking WEB3.")
+
+	client, err := ethclient.Dial(rpcurl)
+	if err != nil {
+		return nil, err
+	}
+
+	clientnetworkid, err := client.NetworkID(context.Background())
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	if clientnetworkid.Uint64() != networkid {
+		client.Close()
+		return nil, fmt.Errorf("NetworkID RPC return a different networkid", networkid)
+	}
+
+	return client, nil
+}
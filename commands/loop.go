@@ -0,0 +1,157 @@
+package commands
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	cfg "github.com/ipfsconsortium/go-ipfsc/config"
+	"github.com/ipfsconsortium/go-ipfsc/service"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultSyncBackoff is the delay to retry a failed sync, doubled on
+	// each consecutive failure up to the sync interval
+	defaultSyncBackoff = time.Minute
+)
+
+// handleSignals returns a context that is cancelled on SIGINT or SIGTERM, so
+// the sync stops after the objects being pinned, and a channel that receives
+// on SIGUSR1 to start a sync at once. A second SIGINT or SIGTERM exits
+// without waiting.
+func handleSignals() (context.Context, <-chan struct{}) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	trigger := make(chan struct{}, 1)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGUSR1)
+
+	go func() {
+		for sig := range signals {
+			if sig == syscall.SIGUSR1 {
+				log.Info("Sync requested")
+				select {
+				case trigger <- struct{}{}:
+				default:
+				}
+				continue
+			}
+			if ctx.Err() != nil {
+				log.Warn("Exiting without waiting for the sync")
+				os.Exit(1)
+			}
+			log.WithField("signal", sig).Info("Stopping, waiting for the current sync")
+			cancel()
+		}
+	}()
+
+	return ctx, trigger
+}
+
+// schedule computes the delays between full syncs.
+type schedule struct {
+	interval time.Duration
+	jitter   time.Duration
+	backoff  time.Duration
+	rand     *rand.Rand
+
+	// delay after the last failed sync, zero if it did not fail
+	failed time.Duration
+}
+
+func newSchedule() *schedule {
+	sched := &schedule{
+		rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	must(sched.load())
+	return sched
+}
+
+// load reads the delays from the config. If a delay is invalid the current
+// ones are kept.
+func (s *schedule) load() error {
+	interval, err := syncInterval()
+	if err != nil {
+		return err
+	}
+	var jitter time.Duration
+	if cfg.C.Sync.Jitter != "" {
+		if jitter, err = time.ParseDuration(cfg.C.Sync.Jitter); err != nil {
+			return err
+		}
+	}
+	backoff := defaultSyncBackoff
+	if cfg.C.Sync.Backoff != "" {
+		if backoff, err = time.ParseDuration(cfg.C.Sync.Backoff); err != nil {
+			return err
+		}
+	}
+	s.interval, s.jitter, s.backoff = interval, jitter, backoff
+	return nil
+}
+
+// next returns the delay to the next full sync after a sync finished: the
+// interval, or a backoff doubled on each consecutive failed sync up to the
+// interval, plus a random jitter.
+func (s *schedule) next(stats service.ServiceStats, err error) time.Duration {
+
+	delay := s.interval
+	if err != nil || stats.Errors > 0 {
+		if s.failed == 0 {
+			s.failed = s.backoff
+		} else {
+			s.failed *= 2
+		}
+		if s.failed > s.interval {
+			s.failed = s.interval
+		}
+		delay = s.failed
+	} else {
+		s.failed = 0
+	}
+
+	if s.jitter > 0 {
+		delay += time.Duration(s.rand.Int63n(int64(s.jitter)))
+	}
+	log.WithField("delay", delay).Info("Next full sync scheduled")
+	return delay
+}
+
+// syncLoopPlain does a full sync every sync interval or when triggered, and
+// applies the reloaded configs between syncs, until ctx is cancelled.
+func syncLoopPlain(ctx context.Context, trigger <-chan struct{}, reloads <-chan cfg.Config, srv *service.Service) {
+
+	sched := newSchedule()
+	for {
+		stats, err := srv.Sync(ctx, cfg.C.EnsNames.Remotes)
+		logStats(stats, err)
+		if ctx.Err() != nil {
+			return
+		}
+
+		timer := time.NewTimer(sched.next(stats, err))
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case newcfg := <-reloads:
+				applyConfig(srv, newcfg)
+				if err := sched.load(); err != nil {
+					log.WithError(err).Error("Invalid sync schedule, keeping the current one")
+				}
+			case <-trigger:
+				timer.Stop()
+				break wait
+			case <-timer.C:
+				break wait
+			}
+		}
+	}
+}
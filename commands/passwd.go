@@ -0,0 +1,121 @@
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	cfg "github.com/ipfsconsortium/go-ipfsc/config"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// keystorePasswd gets the password to unlock the keystore account from the
+// first source configured: a file, an environment variable, the output of a
+// command or, deprecated, the config itself. If none is configured, it is
+// asked if stdin is a terminal.
+func keystorePasswd() (string, error) {
+
+	ks := cfg.C.Keystore
+
+	switch {
+
+	case ks.PasswdFile != "":
+		return readPasswdFile(ks.PasswdFile)
+
+	case ks.PasswdEnv != "":
+		passwd, ok := os.LookupEnv(ks.PasswdEnv)
+		if !ok {
+			return "", fmt.Errorf("Environment variable %v of the keystore password is not set", ks.PasswdEnv)
+		}
+		return passwd, nil
+
+	case ks.PasswdCommand != "":
+		return runPasswdCommand(ks.PasswdCommand)
+
+	case ks.Passwd != "":
+		log.Warn("keystore.passwd is deprecated since it stores the password in plaintext, " +
+			"use keystore.passwdfile, keystore.passwdenv or keystore.passwdcommand instead")
+		return ks.Passwd, nil
+
+	case isTerminal(os.Stdin):
+		return promptPasswd(fmt.Sprintf("Password of account %v: ", ks.Account))
+	}
+
+	return "", fmt.Errorf("No keystore password, set keystore.passwdfile, keystore.passwdenv or keystore.passwdcommand")
+}
+
+// newKeystorePasswd gets the password to encrypt a new account from the
+// source configured, or asks it twice if none is configured.
+func newKeystorePasswd() (string, error) {
+
+	ks := cfg.C.Keystore
+	if ks.PasswdFile != "" || ks.PasswdEnv != "" || ks.PasswdCommand != "" || ks.Passwd != "" || !isTerminal(os.Stdin) {
+		return keystorePasswd()
+	}
+
+	passwd, err := promptPasswd("Password of the new account: ")
+	if err != nil {
+		return "", err
+	}
+	again, err := promptPasswd("Repeat the password: ")
+	if err != nil {
+		return "", err
+	}
+	if passwd != again {
+		return "", fmt.Errorf("Passwords do not match")
+	}
+	return passwd, nil
+}
+
+// promptPasswd asks a password in the terminal, without echoing it.
+func promptPasswd(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	passwd, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	return string(passwd), err
+}
+
+// readPasswdFile reads a password from the first line of a file, that must
+// not be accessible by other users.
+func readPasswdFile(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return "", fmt.Errorf("Password file %v has permissions %v, it must not be accessible by group or others (chmod 600)", path, info.Mode().Perm())
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return firstLine(string(data)), nil
+}
+
+// runPasswdCommand runs a command with the shell, and returns the first line
+// of its output as the password. The command can use the terminal to ask
+// for a passphrase.
+func runPasswdCommand(command string) (string, error) {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("Password command failed: %v", err)
+	}
+	passwd := firstLine(string(output))
+	if passwd == "" {
+		return "", fmt.Errorf("Password command returned no password")
+	}
+	return passwd, nil
+}
+
+func firstLine(text string) string {
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		text = text[:i]
+	}
+	return strings.TrimSuffix(text, "\r")
+}
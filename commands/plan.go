@@ -0,0 +1,44 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/ipfsconsortium/go-ipfsc/service"
+)
+
+// printPlan prints a sync plan as tables or as JSON.
+func printPlan(out io.Writer, plan *service.SyncPlan, asJSON bool) error {
+
+	if asJSON {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(plan)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(w, "ACTION\tHASH\tSIZE\tPATH")
+	for _, entry := range plan.Entries {
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", entry.Action, entry.Hash, entry.Size, entry.Path)
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintln(w, "MEMBER\tQUOTUM\tUSED\tREJECTED\tSTATUS")
+	for _, member := range plan.Members {
+		status := "ok"
+		if member.Exceeded {
+			status = "exceeded"
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n", member.Name, member.Quotum, member.Used, member.Rejected, status)
+	}
+	fmt.Fprintln(w)
+
+	stats := plan.Stats
+	fmt.Fprintf(w, "pin: %v, unpin: %v, quarantine: %v, carried: %v, errors: %v\n",
+		stats.Pinned, stats.Unpinned, stats.Quarantined, stats.Carried, stats.Errors)
+
+	return w.Flush()
+}
@@ -0,0 +1,169 @@
+package commands
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	cfg "github.com/ipfsconsortium/go-ipfsc/config"
+	"github.com/ipfsconsortium/go-ipfsc/service"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const (
+	// configPollInterval is the time between checks of the config file
+	configPollInterval = 5 * time.Second
+)
+
+// watchConfig reloads the config file on SIGHUP or when it is modified, and
+// sends the valid new configs to the returned channel. Invalid configs are
+// logged and discarded. Only the last config not yet received is kept.
+func watchConfig() <-chan cfg.Config {
+
+	reloads := make(chan cfg.Config, 1)
+
+	reload := func(reason string) {
+		newcfg, err := readConfig()
+		if err != nil {
+			log.WithError(err).WithField("reason", reason).Error("Invalid config, keeping the current one")
+			return
+		}
+		select {
+		case <-reloads:
+		default:
+		}
+		reloads <- *newcfg
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		ticker := time.NewTicker(configPollInterval)
+		modtime := configModTime()
+		for {
+			select {
+			case <-hup:
+				reload("SIGHUP")
+			case <-ticker.C:
+				if t := configModTime(); !t.Equal(modtime) {
+					modtime = t
+					reload("file modified")
+				}
+			}
+		}
+	}()
+
+	return reloads
+}
+
+// readConfig reads again the config file, and validates it.
+func readConfig() (*cfg.Config, error) {
+	if err := viper.ReadInConfig(); err != nil {
+		return nil, err
+	}
+	var newcfg cfg.Config
+	if err := viper.Unmarshal(&newcfg); err != nil {
+		return nil, err
+	}
+	if err := newcfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &newcfg, nil
+}
+
+func configModTime() time.Time {
+	info, err := os.Stat(viper.ConfigFileUsed())
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// applyConfig applies a reloaded config. The remotes and the sync settings
+// are used from the next sync, and the web3 and IPFS clients are reconnected
+// if their endpoints changed, keeping the current config if they cannot or if
+// the sync settings are invalid. The
+// db and the api cannot be changed without a restart. Returns true if the
+// event scanner must be restarted.
+func applyConfig(srv *service.Service, newcfg cfg.Config) bool {
+
+	for _, field := range cfg.Changes(&cfg.C, &newcfg) {
+		if field == "db.path" || field == "api.port" {
+			log.WithField("field", field).Warn("Config change needs a restart")
+		}
+	}
+	newcfg.DB = cfg.C.DB
+	newcfg.API = cfg.C.API
+
+	changed := cfg.Changes(&cfg.C, &newcfg)
+	if len(changed) == 0 {
+		log.Info("Config reloaded without changes")
+		return false
+	}
+
+	reconnect, restart := false, false
+	for _, field := range changed {
+		switch field {
+		case "ipfs.apiurl", "ipfs.timeout", "networks", "ensnames.network":
+			reconnect = true
+		case "sync.scan":
+			restart = true
+		}
+	}
+
+	oldcfg := cfg.C
+	cfg.C = newcfg
+	// the sync settings are tried on a scratch service and schedule first, so
+	//   nothing is applied if they are invalid
+	err := configureService(&service.Service{})
+	if err == nil {
+		err = (&schedule{}).load()
+	}
+	if err != nil {
+		log.WithError(err).Error("Invalid sync settings, keeping the current config")
+		cfg.C = oldcfg
+		return false
+	}
+	if reconnect {
+		if err := reconnectClients(); err != nil {
+			log.WithError(err).Error("Failed to reconnect with the new config, keeping the current one")
+			cfg.C = oldcfg
+			return false
+		}
+		srv.SetIpfsc(ipfsc)
+	}
+	if err := configureService(srv); err != nil {
+		log.WithError(err).Error("Failed to apply the sync settings")
+	}
+
+	log.WithField("changed", changed).Info("Config reloaded")
+	return reconnect || restart
+}
+
+// reconnectClients connects again the web3 and IPFS clients with the current
+// config, and closes the previous ones. If it fails the previous clients are
+// kept.
+func reconnectClients() error {
+
+	oldclients, oldipfsc := ethclients, ipfsc
+
+	err := loadEthClients()
+	if err == nil {
+		err = loadIPFSC(false)
+	}
+	if err != nil {
+		for _, client := range ethclients {
+			client.Close()
+		}
+		ethclients, ipfsc = oldclients, oldipfsc
+		return err
+	}
+
+	for _, client := range oldclients {
+		client.Close()
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// SavePointShow command
+func SavePointShow(cmd *cobra.Command, args []string) {
+
+	must(loadStorage())
+
+	entry, err := storage.SavePointEntry()
+	if err != nil {
+		log.WithError(err).Error("Failed to read savepoint")
+		return
+	}
+	if entry == nil {
+		fmt.Println("No savepoint, scanning starts at the last block")
+	} else {
+		fmt.Printf("Block: %v\nTxIndex: %v\nLogIndex: %v\n",
+			entry.LastBlock, entry.LastTxIndex, entry.LastLogIndex,
+		)
+	}
+
+	txids, err := storage.SkipTxs()
+	if err != nil {
+		log.WithError(err).Error("Failed to read skipped transactions")
+		return
+	}
+	for _, txid := range txids {
+		fmt.Println("SkipTx: " + txid.Hex())
+	}
+}
+
+// SavePointReset command
+func SavePointReset(cmd *cobra.Command, args []string) {
+
+	must(loadStorage())
+
+	if err := storage.ResetSavePoint(); err != nil {
+		log.WithError(err).Error("Failed to reset savepoint")
+		return
+	}
+	log.Info("Savepoint sucessfully reset")
+}
+
+// SavePointSet command
+func SavePointSet(cmd *cobra.Command, args []string) {
+
+	must(loadStorage())
+
+	block, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		log.WithError(err).Error("Invalid block number")
+		return
+	}
+	if err := storage.MoveSavePoint(block); err != nil {
+		log.WithError(err).Error("Failed to set savepoint")
+		return
+	}
+	log.WithField("block", block).Info("Savepoint sucessfully set")
+}
+
+// SavePointSkipTx command
+func SavePointSkipTx(cmd *cobra.Command, args []string) {
+
+	must(loadStorage())
+
+	remove, _ := cmd.Flags().GetBool("remove")
+
+	for _, arg := range args {
+		txid := common.HexToHash(arg)
+		if remove {
+			if err := storage.RemoveSkipTx(txid); err != nil {
+				log.WithError(err).Error("Failed to remove skipped tx ", arg)
+				return
+			}
+			continue
+		}
+		if err := storage.AddSkipTx(txid); err != nil {
+			log.WithError(err).Error("Failed to skip tx ", arg)
+			return
+		}
+	}
+	log.Info("Skipped transactions sucessfully updated")
+}
@@ -0,0 +1,36 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ipfsconsortium/go-ipfsc/service"
+	"github.com/spf13/cobra"
+)
+
+// Why command
+func Why(cmd *cobra.Command, args []string) {
+
+	must(loadStorage())
+
+	info, err := service.Why(storage, args[0])
+	must(err)
+
+	if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		must(encoder.Encode(info))
+		return
+	}
+
+	fmt.Printf("%v: %v\n", info.Hash, info.Status)
+	for _, chain := range info.Chains {
+		fmt.Printf("  %v > %v (member: %v, epoch: %v)\n", chain.Root, chain.Path, chain.Member, chain.Epoch)
+		fmt.Printf("    %v\n", strings.Join(chain.Objects, " > "))
+	}
+	if info.Truncated {
+		fmt.Println("  ...")
+	}
+}
@@ -8,7 +8,13 @@ type Config struct {
 	Keystore struct {
 		Account string
 		Path    string
-		Passwd  string
+
+		// Passwd is the password in plaintext, deprecated by PasswdFile,
+		//   PasswdEnv and PasswdCommand
+		Passwd        string
+		PasswdFile    string
+		PasswdEnv     string
+		PasswdCommand string
 	}
 
 	EnsNames struct {
@@ -27,12 +33,30 @@ type Config struct {
 	}
 
 	Networks map[uint64]struct {
-		MaxGasPrice uint64
-		EnsRoot     string
-		RPCURL      string
+		MaxGasPrice   uint64
+		EnsRoot       string
+		RPCURL        string
+		WSURL         string
+		Confirmations uint64
 	}
 
 	API struct {
 		Port int
 	}
+
+	Sync struct {
+		MaxDepth    int
+		Interval    string
+		Jitter      string
+		Backoff     string
+		Scan        string
+		GraceSyncs  uint
+		GracePeriod string
+		Workers     int
+		PinMode     string
+
+		RetryDelay    string
+		MaxRetryDelay string
+		MaxRetries    uint
+	}
 }
@@ -0,0 +1,200 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Check validates all the fields of the config, returns an error for each
+// invalid one.
+func (c *Config) Check() []error {
+
+	var errs []error
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if c.Keystore.Account != "" {
+		if !common.IsHexAddress(c.Keystore.Account) {
+			fail("keystore.account '%v' is not an address", c.Keystore.Account)
+		}
+		if c.Keystore.Path == "" {
+			fail("keystore.path is not set")
+		}
+	}
+	sources := 0
+	for _, source := range []string{c.Keystore.PasswdFile, c.Keystore.PasswdEnv, c.Keystore.PasswdCommand} {
+		if source != "" {
+			sources++
+		}
+	}
+	if sources > 1 {
+		fail("keystore has more than one of passwdfile, passwdenv and passwdcommand")
+	}
+
+	if _, ok := c.Networks[c.EnsNames.Network]; !ok {
+		fail("ensnames.network %v is not defined in networks", c.EnsNames.Network)
+	}
+	for i, remote := range c.EnsNames.Remotes {
+		switch {
+		case strings.HasPrefix(remote, "/ipfs/"):
+		case strings.HasPrefix(remote, "0x"):
+			if !common.IsHexAddress(remote) {
+				fail("ensnames.remotes[%v] '%v' is not an address", i, remote)
+			}
+		case strings.Contains(remote, ".eth"):
+		default:
+			fail("ensnames.remotes[%v] '%v' is not an IPFS hash, address or ENS name", i, remote)
+		}
+	}
+
+	if c.DB.Path == "" {
+		fail("db.path is not set")
+	}
+
+	if c.IPFS.APIURL == "" {
+		fail("ipfs.apiurl is not set")
+	} else if err := checkURL(c.IPFS.APIURL, false, "http", "https"); err != nil {
+		fail("ipfs.apiurl %v", err)
+	}
+
+	if len(c.Networks) == 0 {
+		fail("networks is empty")
+	}
+	networkids := make([]uint64, 0, len(c.Networks))
+	for networkid := range c.Networks {
+		networkids = append(networkids, networkid)
+	}
+	sort.Slice(networkids, func(i, j int) bool { return networkids[i] < networkids[j] })
+	for _, networkid := range networkids {
+		network := c.Networks[networkid]
+		if networkid == 0 {
+			fail("networks.0 is not a valid network id")
+		}
+		if !common.IsHexAddress(network.EnsRoot) {
+			fail("networks.%v.ensroot '%v' is not an address", networkid, network.EnsRoot)
+		}
+		if network.RPCURL == "" {
+			fail("networks.%v.rpcurl is not set", networkid)
+		} else if err := checkURL(network.RPCURL, true, "http", "https", "ws", "wss"); err != nil {
+			fail("networks.%v.rpcurl %v", networkid, err)
+		}
+		if network.WSURL != "" {
+			if err := checkURL(network.WSURL, true, "ws", "wss"); err != nil {
+				fail("networks.%v.wsurl %v", networkid, err)
+			}
+		}
+	}
+
+	if c.API.Port < 0 || c.API.Port > 65535 {
+		fail("api.port %v is not a valid port", c.API.Port)
+	}
+
+	durations := []struct {
+		name  string
+		value string
+	}{
+		{"ipfs.timeout", c.IPFS.Timeout},
+		{"sync.interval", c.Sync.Interval},
+		{"sync.jitter", c.Sync.Jitter},
+		{"sync.backoff", c.Sync.Backoff},
+		{"sync.graceperiod", c.Sync.GracePeriod},
+		{"sync.retrydelay", c.Sync.RetryDelay},
+		{"sync.maxretrydelay", c.Sync.MaxRetryDelay},
+	}
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+		if duration, err := time.ParseDuration(d.value); err != nil || duration < 0 {
+			fail("%v '%v' is not a valid duration, e.g. 90s, 10m or 1h", d.name, d.value)
+		}
+	}
+
+	if c.Sync.MaxDepth < 0 {
+		fail("sync.maxdepth %v is negative", c.Sync.MaxDepth)
+	}
+	if c.Sync.Workers < 0 {
+		fail("sync.workers %v is negative", c.Sync.Workers)
+	}
+
+	switch c.Sync.PinMode {
+	case "", "direct", "recursive":
+	default:
+		fail("sync.pinmode '%v' is not direct or recursive", c.Sync.PinMode)
+	}
+
+	switch c.Sync.Scan {
+	case "", "logs", "receipts":
+	case "subscribe":
+		if c.Networks[c.EnsNames.Network].WSURL == "" {
+			fail("sync.scan subscribe needs networks.%v.wsurl", c.EnsNames.Network)
+		}
+	default:
+		fail("sync.scan '%v' is not logs, receipts or subscribe", c.Sync.Scan)
+	}
+
+	return errs
+}
+
+// Validate checks that the config can be used, returns the first invalid
+// field found.
+func (c *Config) Validate() error {
+	if errs := c.Check(); len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// checkURL checks that value is an URL with one of the schemes, or an IPC
+// path if allowed.
+func checkURL(value string, ipc bool, schemes ...string) error {
+	u, err := url.Parse(value)
+	if err == nil && u.Scheme == "" && ipc {
+		return nil
+	}
+	if err == nil && u.Host != "" {
+		for _, scheme := range schemes {
+			if u.Scheme == scheme {
+				return nil
+			}
+		}
+	}
+	if ipc {
+		return fmt.Errorf("'%v' is not a %v URL or an IPC path", value, strings.Join(schemes, "/"))
+	}
+	return fmt.Errorf("'%v' is not a %v URL", value, strings.Join(schemes, "/"))
+}
+
+// Changes returns the names of the fields that differ between two configs,
+// as written in the config file, e.g. ipfs.apiurl. Maps and lists are
+// compared as a whole.
+func Changes(old, new *Config) []string {
+	return changes("", reflect.ValueOf(*old), reflect.ValueOf(*new))
+}
+
+func changes(prefix string, old, new reflect.Value) []string {
+
+	if old.Kind() != reflect.Struct {
+		if reflect.DeepEqual(old.Interface(), new.Interface()) {
+			return nil
+		}
+		return []string{prefix}
+	}
+
+	var changed []string
+	for i := 0; i < old.NumField(); i++ {
+		name := strings.ToLower(old.Type().Field(i).Name)
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		changed = append(changed, changes(name, old.Field(i), new.Field(i))...)
+	}
+	return changed
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func validConfig() *Config {
+	var c Config
+	c.DB.Path = "/tmp/goicdb"
+	c.IPFS.APIURL = "http://localhost:5001"
+	c.IPFS.Timeout = "60s"
+	c.EnsNames.Network = 1
+	c.Networks = map[uint64]struct {
+		MaxGasPrice   uint64
+		EnsRoot       string
+		RPCURL        string
+		WSURL         string
+		Confirmations uint64
+	}{
+		1: {
+			EnsRoot: "0x314159265dd8dbb310642f98f50c066173c1259b",
+			RPCURL:  "http://localhost:8545",
+		},
+	}
+	return &c
+}
+
+func TestValidate(t *testing.T) {
+	c := validConfig()
+	assert.Nil(t, c.Validate())
+
+	c.Sync.Interval = "1 hour"
+	assert.NotNil(t, c.Validate())
+
+	c = validConfig()
+	c.Sync.PinMode = "all"
+	assert.NotNil(t, c.Validate())
+
+	c = validConfig()
+	c.Sync.Scan = "subscribe"
+	assert.NotNil(t, c.Validate())
+
+	c = validConfig()
+	c.EnsNames.Network = 3
+	assert.NotNil(t, c.Validate())
+}
+
+func TestCheck(t *testing.T) {
+	c := validConfig()
+	assert.Equal(t, 0, len(c.Check()))
+
+	c.Keystore.Account = "0x1234"
+	c.EnsNames.Remotes = []string{"set1.eth", "/ipfs/QmHash", "set2"}
+	c.IPFS.APIURL = "localhost:5001"
+	c.IPFS.Timeout = "60"
+	errs := c.Check()
+	assert.Equal(t, 5, len(errs))
+	assert.Equal(t, "keystore.account '0x1234' is not an address", errs[0].Error())
+	assert.Equal(t, "keystore.path is not set", errs[1].Error())
+	assert.Equal(t, "ensnames.remotes[2] 'set2' is not an IPFS hash, address or ENS name", errs[2].Error())
+	assert.Equal(t, "ipfs.apiurl 'localhost:5001' is not a http/https URL", errs[3].Error())
+	assert.Equal(t, "ipfs.timeout '60' is not a valid duration, e.g. 90s, 10m or 1h", errs[4].Error())
+}
+
+func TestChanges(t *testing.T) {
+	old := validConfig()
+	new := validConfig()
+	assert.Equal(t, 0, len(Changes(old, new)))
+
+	new.IPFS.Timeout = "30s"
+	new.EnsNames.Remotes = []string{"set1.eth"}
+	assert.Equal(t, []string{"ensnames.remotes", "ipfs.timeout"}, Changes(old, new))
+}
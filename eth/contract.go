@@ -139,12 +139,23 @@ func (c *Contract) DeploySync(params ...interface{}) (*types.Transaction, *types
 
 // Call an constant method
 func (c *Contract) Call(ret interface{}, funcname string, params ...interface{}) error {
+	return c.CallContext(context.TODO(), ret, funcname, params...)
+}
+
+// CallContext calls a constant method, that is cancelled with ctx.
+func (c *Contract) CallContext(ctx context.Context, ret interface{}, funcname string, params ...interface{}) error {
+	return c.CallContextAt(ctx, nil, ret, funcname, params...)
+}
+
+// CallContextAt calls a constant method on the state of a block, the last one
+// if block is nil.
+func (c *Contract) CallContextAt(ctx context.Context, block *big.Int, ret interface{}, funcname string, params ...interface{}) error {
 
 	input, err := c.abi.Pack(funcname, params...)
 	if err != nil {
 		return err
 	}
-	output, err := c.client.Call(c.address, big.NewInt(0), input)
+	output, err := c.client.CallContextAt(ctx, c.address, big.NewInt(0), input, block)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,191 @@
+package eth
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// initialLogsRange is the number of blocks filtered in the first query
+	initialLogsRange = 100
+	// defaultMaxLogsRange is the default maximum number of blocks filtered at once
+	defaultMaxLogsRange = 10000
+)
+
+// tooManyResultsErrors are the messages returned by the providers when a
+// logs query must be split in smaller ranges.
+var tooManyResultsErrors = []string{
+	"query returned more than",
+	"too many results",
+	"response size exceeded",
+	"limit exceeded",
+	"block range",
+}
+
+func isTooManyResults(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, tooMany := range tooManyResultsErrors {
+		if strings.Contains(msg, tooMany) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterQuery returns the query that matches the registered handlers.
+func (e *ScanEventDispatcher) filterQuery(from, to uint64) ethereum.FilterQuery {
+
+	addresses := []common.Address{}
+	topics := []common.Hash{}
+	seen := make(map[string]bool)
+
+	e.Lock()
+	for _, handler := range e.eventHandlers {
+		if !seen[handler.Address.Hex()] {
+			seen[handler.Address.Hex()] = true
+			addresses = append(addresses, handler.Address)
+		}
+		if !seen[handler.Topic] {
+			seen[handler.Topic] = true
+			topics = append(topics, common.HexToHash(handler.Topic))
+		}
+	}
+	e.Unlock()
+
+	return ethereum.FilterQuery{
+		FromBlock: new(big.Int).SetUint64(from),
+		ToBlock:   new(big.Int).SetUint64(to),
+		Addresses: addresses,
+		Topics:    [][]common.Hash{topics},
+	}
+}
+
+// alreadyProcessed returns if the log is before the next log to be processed.
+func (e *ScanEventDispatcher) alreadyProcessed(logevent *types.Log) bool {
+	if logevent.BlockNumber != e.nextBlock {
+		return logevent.BlockNumber < e.nextBlock
+	}
+	return logevent.TxIndex < e.nextTxIndex ||
+		(logevent.TxIndex == e.nextTxIndex && logevent.Index < e.nextLogIndex)
+}
+
+// processLogs filters the logs of the registered handlers in a range of
+// confirmed blocks.
+func (e *ScanEventDispatcher) processLogs() (bool, error) {
+	return e.filterLogs(e.ConfirmationDepth)
+}
+
+// filterLogs filters the logs of the registered handlers in a range of blocks
+// with depth blocks on top, the range grows while queries succeed, and it is
+// split when the provider returns too many results.
+func (e *ScanEventDispatcher) filterLogs(depth uint64) (bool, error) {
+
+	if err := e.load(); err != nil {
+		return false, err
+	}
+
+	ctx := context.TODO()
+
+	head, err := e.client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	if head.Number.Uint64() < e.nextBlock+depth {
+		return true, nil
+	}
+	from := e.nextBlock
+	to := head.Number.Uint64() - depth
+	if to-from+1 > e.logsRange {
+		to = from + e.logsRange - 1
+	}
+
+	// Check if the chain has been reorganized.
+	if len(e.history) > 0 {
+		header, err := e.client.HeaderByNumber(ctx, new(big.Int).SetUint64(from))
+		if err == ethereum.NotFound {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if reorg, err := e.checkReorg(from, header.ParentHash); err != nil || reorg {
+			return false, err
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"from":         from,
+		"to":           to,
+		"block/tx/log": fmt.Sprintf("%v/%v/%v", e.nextBlock, e.nextTxIndex, e.nextLogIndex),
+	}).Info("EVENT filtering logs")
+
+	logs := []types.Log{}
+	query := e.filterQuery(from, to)
+	if len(query.Addresses) > 0 {
+		logs, err = e.client.FilterLogs(ctx, query)
+		if err != nil && isTooManyResults(err) && e.logsRange > 1 {
+			e.logsRange /= 2
+			log.WithError(err).WithField("range", e.logsRange).Debug("EVENT splitting logs range")
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+
+	for i := range logs {
+		logevent := &logs[i]
+		if logevent.Removed || e.alreadyProcessed(logevent) {
+			continue
+		}
+		// transactions marked as skip are not processed
+		skip, err := e.savepoint.SkipTx(logevent.TxHash)
+		if err != nil {
+			return false, err
+		}
+		if skip {
+			continue
+		}
+		if err := e.runHandlerFor(logevent); err != nil {
+			log.WithFields(log.Fields{
+				"err":  err,
+				"txid": logevent.TxHash.Hex(),
+			}).Warn("EVENT Failed handling ")
+			return false, err
+		}
+		e.blockLogs = append(e.blockLogs, logevent)
+		if err := e.savepoint.Save(logevent); err != nil {
+			return false, err
+		}
+	}
+
+	header, err := e.client.HeaderByNumber(ctx, new(big.Int).SetUint64(to))
+	if err != nil {
+		return false, err
+	}
+	if err := e.processed(to, header.Hash()); err != nil {
+		return false, err
+	}
+
+	// mark the whole range as processed
+	if err := e.savepoint.SaveBlock(to); err != nil {
+		return false, err
+	}
+	e.nextBlock, e.nextTxIndex, e.nextLogIndex = to+1, 0, 0
+	if e.logsRange < e.MaxLogsRange {
+		e.logsRange *= 2
+		if e.logsRange > e.MaxLogsRange {
+			e.logsRange = e.MaxLogsRange
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,94 @@
+package eth
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+// skipSavePoint is a MemorySavePoint that skips some transactions.
+type skipSavePoint struct {
+	*MemorySavePoint
+	sync.Mutex
+	skip map[common.Hash]bool
+}
+
+func (p *skipSavePoint) SkipTx(txid common.Hash) (bool, error) {
+	p.Mutex.Lock()
+	defer p.Mutex.Unlock()
+	return p.skip[txid], nil
+}
+
+func (p *skipSavePoint) skipTx(txid common.Hash) {
+	p.Mutex.Lock()
+	defer p.Mutex.Unlock()
+	p.skip[txid] = true
+}
+
+func TestLogsRangeSplit(t *testing.T) {
+	chain := newTestChain(t, 41)
+	chain.addLog(5)
+	chain.addLog(30)
+	chain.maxRange = 10
+
+	handled := &testHandled{}
+	e := newTestDispatcher(t, chain, NewMemorySavePoint(1), handled)
+	e.MaxLogsRange = 64
+	e.logsRange = 64
+
+	// the range is halved while there are too many results, and grows
+	//   again when the queries succeed
+	scanAll(t, e)
+	assert.Equal(t, []int{5, 30}, handled.handled())
+	assert.Equal(t, [][2]uint64{
+		{1, 40}, {1, 32}, {1, 16}, {1, 8},
+		{9, 24}, {9, 16},
+		{17, 32}, {17, 24},
+		{25, 40}, {25, 32},
+		{33, 40},
+	}, chain.ranges)
+}
+
+func TestLogsSaveBlock(t *testing.T) {
+	chain := newTestChain(t, 21)
+	chain.addLog(3)
+
+	savepoint := NewMemorySavePoint(1)
+	handled := &testHandled{}
+	e := newTestDispatcher(t, chain, savepoint, handled)
+	e.MaxLogsRange = 8
+	e.logsRange = 8
+	e.ConfirmationDepth = 5
+
+	// the savepoint advances to the end of each range, even without events
+	wait, err := e.processLogs()
+	assert.Nil(t, err)
+	assert.False(t, wait)
+	block, txindex, _, err := savepoint.Load()
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(8), block)
+	assert.Equal(t, uint(0xffffffff), txindex)
+
+	// up to the last confirmed block
+	scanAll(t, e)
+	block, _, _, err = savepoint.Load()
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(15), block)
+	assert.Equal(t, []int{3}, handled.handled())
+}
+
+func TestLogsSkipTx(t *testing.T) {
+	chain := newTestChain(t, 11)
+	skipped := chain.addLog(5)
+	chain.addLog(6)
+
+	savepoint := &skipSavePoint{
+		MemorySavePoint: NewMemorySavePoint(1),
+		skip:            map[common.Hash]bool{skipped.TxHash: true},
+	}
+	handled := &testHandled{}
+	scanAll(t, newTestDispatcher(t, chain, savepoint, handled))
+	assert.Equal(t, []int{6}, handled.handled())
+}
@@ -0,0 +1,59 @@
+package eth
+
+import (
+	"math"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// MemorySavePoint is a SavePoint that is not persisted, scanning starts at
+// the specified block each time the program is started.
+type MemorySavePoint struct {
+	sync.Mutex
+
+	lastBlock    uint64
+	lastTxIndex  uint
+	lastLogIndex uint
+}
+
+func NewMemorySavePoint(block uint64) *MemorySavePoint {
+	return &MemorySavePoint{lastBlock: block}
+}
+
+// Load the last processed log.
+func (m *MemorySavePoint) Load() (lastBlock uint64, lastTxIndex, lastLogIndex uint, err error) {
+	m.Lock()
+	defer m.Unlock()
+
+	return m.lastBlock, m.lastTxIndex, m.lastLogIndex, nil
+}
+
+// Save the last processed log.
+func (m *MemorySavePoint) Save(logevent *types.Log) error {
+	m.Lock()
+	defer m.Unlock()
+
+	m.lastBlock = logevent.BlockNumber
+	m.lastTxIndex = logevent.TxIndex
+	m.lastLogIndex = logevent.Index
+	return nil
+}
+
+// SaveBlock saves the end of the block as the last processed log.
+func (m *MemorySavePoint) SaveBlock(block uint64) error {
+	m.Lock()
+	defer m.Unlock()
+
+	m.lastBlock = block
+	m.lastTxIndex = math.MaxUint32
+	m.lastLogIndex = 0
+	return nil
+}
+
+// SkipTx returns if the transaction should not be processed, no transaction
+// is skipped.
+func (m *MemorySavePoint) SkipTx(txid common.Hash) (bool, error) {
+	return false, nil
+}
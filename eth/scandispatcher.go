@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"math/big"
 	"sync"
@@ -18,12 +19,40 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// EventHandlerFunc handles an event, events reverted by a chain reorganization
+// are notified again with logevent.Removed set.
 type EventHandlerFunc func(*types.Log, *ScanEventHandler) error
 
 type SavePoint interface {
 	Load() (lastBlock uint64, lastTxIndex, lastLogIndex uint, err error)
 	Save(logevent *types.Log) error
 	SkipTx(txid common.Hash) (bool, error)
+	// SaveBlock saves the end of the block as the last processed log
+	SaveBlock(block uint64) error
+}
+
+const (
+	// reorgHistoryLen is the number of processed blocks kept to detect reorgs
+	reorgHistoryLen = 256
+)
+
+var (
+	errReorgTooDeep = errors.New("chain reorganization deeper than processed blocks history")
+)
+
+// ProcessedBlock is a block already processed, with the handled events.
+type ProcessedBlock struct {
+	Number uint64
+	Hash   common.Hash
+	Logs   []*types.Log
+}
+
+// BlockHistory is implemented by the savepoints that also persist the recent
+// processed blocks, so the reorganizations that happened while stopped are
+// detected when scanning is resumed.
+type BlockHistory interface {
+	LoadHistory() ([]ProcessedBlock, error)
+	SaveHistory(history []ProcessedBlock) error
 }
 
 type ScanEventHandler struct {
@@ -34,23 +63,69 @@ type ScanEventHandler struct {
 	UserData  interface{}
 }
 
+// ScanMode is how the dispatcher looks for events
+type ScanMode int
+
+const (
+	// ScanReceipts downloads all blocks and their transaction receipts
+	ScanReceipts ScanMode = iota
+	// ScanLogs filters the logs of the registered handlers with eth_getLogs
+	ScanLogs
+	// ScanSubscribe receives the logs of the registered handlers from a
+	//   websocket/IPC subscription, and backfills up to the head with
+	//   eth_getLogs. Logs are handled without waiting for confirmations,
+	//   reorganizations are notified by the node as removed logs
+	ScanSubscribe
+)
+
+// ScanStatus is the status of the scanning, with the consecutive failures,
+// the last error and when scanning is retried, if it is failing.
+type ScanStatus struct {
+	Failures  int       `json:"failures"`
+	LastError string    `json:"lasterror,omitempty"`
+	NextRetry time.Time `json:"nextretry,omitempty"`
+}
+
 type ScanEventDispatcher struct {
 	sync.Mutex
 
+	// Mode is how events are scanned, ScanReceipts by default
+	Mode ScanMode
+
+	// MaxLogsRange is the maximum number of blocks filtered at once in ScanLogs mode
+	MaxLogsRange uint64
+
+	// SubscribeURL is the websocket/IPC endpoint used in ScanSubscribe mode
+	SubscribeURL string
+
+	// ConfirmationDepth is the number of blocks on top of a block before it
+	//   is processed
+	ConfirmationDepth uint64
+
 	client *ethclient.Client
 
-	eventHandlers []ScanEventHandler
-	savepoint     SavePoint
+	eventHandlers   []ScanEventHandler
+	handlersVersion int
+	savepoint       SavePoint
 
 	block    *types.Block
 	receipts *ReceiptDownloader
 
 	terminatech  chan interface{}
 	terminatedch chan interface{}
+	stopOnce     sync.Once
+
+	// status of the scanning, guarded by the mutex
+	status ScanStatus
 
 	nextBlock    uint64
 	nextTxIndex  uint
 	nextLogIndex uint
+
+	history   []ProcessedBlock
+	blockLogs []*types.Log
+
+	logsRange uint64
 }
 
 func NewScanEventDispatcher(client *ethclient.Client, savepoint SavePoint) *ScanEventDispatcher {
@@ -61,6 +136,9 @@ func NewScanEventDispatcher(client *ethclient.Client, savepoint SavePoint) *Scan
 
 		receipts: NewReceiptDownloader(client, 3),
 
+		MaxLogsRange: defaultMaxLogsRange,
+		logsRange:    initialLogsRange,
+
 		terminatech:  make(chan interface{}),
 		terminatedch: make(chan interface{}),
 	}
@@ -86,6 +164,7 @@ func (e *ScanEventDispatcher) RegisterHandler(address common.Address, abi *abi.A
 
 	e.Lock()
 	e.eventHandlers = append(e.eventHandlers, eventHandler)
+	e.handlersVersion++
 	e.Unlock()
 }
 
@@ -98,6 +177,7 @@ func (e *ScanEventDispatcher) UnregisterHandler(address common.Address, event st
 		if bytes.Equal(handler.Address[:], address[:]) && handler.EventName == event {
 			e.eventHandlers[i] = e.eventHandlers[len(e.eventHandlers)-1]
 			e.eventHandlers = e.eventHandlers[:len(e.eventHandlers)-1]
+			e.handlersVersion++
 			return
 		}
 	}
@@ -106,38 +186,187 @@ func (e *ScanEventDispatcher) UnregisterHandler(address common.Address, event st
 
 func (e *ScanEventDispatcher) runHandlerFor(logevent *types.Log) error {
 
-	if !logevent.Removed {
+	var handler *ScanEventHandler
+	e.Lock()
+	for _, v := range e.eventHandlers {
+		if logevent.Address == v.Address && logevent.Topics[0].Hex() == v.Topic {
+			handler = &v
+			break
+		}
+	}
+	e.Unlock()
 
-		var handler *ScanEventHandler
-		e.Lock()
-		for _, v := range e.eventHandlers {
-			if logevent.Address == v.Address && logevent.Topics[0].Hex() == v.Topic {
-				handler = &v
-				break
-			}
+	if handler != nil {
+		log.WithFields(log.Fields{
+			"event":   handler.EventName,
+			"removed": logevent.Removed,
+		}).Debug("EVENT run handler ")
+		return handler.Handler(logevent, handler)
+	}
+
+	return nil
+}
+
+// confirmed returns if the block has enough confirmations to be processed.
+func (e *ScanEventDispatcher) confirmed(number uint64) (bool, error) {
+
+	if e.ConfirmationDepth == 0 {
+		return true, nil
+	}
+	header, err := e.client.HeaderByNumber(context.TODO(), nil)
+	if err != nil {
+		return false, err
+	}
+	return number+e.ConfirmationDepth <= header.Number.Uint64(), nil
+}
+
+// processed adds a block to the history of processed blocks, with the events
+// handled since the previous one.
+func (e *ScanEventDispatcher) processed(number uint64, hash common.Hash) error {
+
+	e.history = append(e.history, ProcessedBlock{
+		Number: number,
+		Hash:   hash,
+		Logs:   e.blockLogs,
+	})
+	if len(e.history) > reorgHistoryLen {
+		e.history = e.history[1:]
+	}
+	e.blockLogs = nil
+	return e.saveHistory()
+}
+
+// saveHistory persists the history of processed blocks, if the savepoint
+// supports it.
+func (e *ScanEventDispatcher) saveHistory() error {
+	if history, ok := e.savepoint.(BlockHistory); ok {
+		return history.SaveHistory(e.history)
+	}
+	return nil
+}
+
+// loadHistory loads the persisted history of processed blocks up to the
+// savepoint, and checks that its last block is still in the chain.
+func (e *ScanEventDispatcher) loadHistory() error {
+
+	history, ok := e.savepoint.(BlockHistory)
+	if !ok {
+		return nil
+	}
+	blocks, err := history.LoadHistory()
+	if err != nil {
+		return err
+	}
+	e.history = nil
+	for _, block := range blocks {
+		if block.Number <= e.nextBlock {
+			e.history = append(e.history, block)
+		}
+	}
+	if len(e.history) == 0 {
+		return nil
+	}
+
+	last := e.history[len(e.history)-1]
+	header, err := e.client.HeaderByNumber(context.TODO(), new(big.Int).SetUint64(last.Number))
+	if err != nil && err != ethereum.NotFound {
+		return err
+	}
+	if err == nil && header.Hash() == last.Hash {
+		return nil
+	}
+	log.WithField("block", last.Number).Warn("EVENT chain reorganized while stopped")
+	return e.rollback()
+}
+
+// checkReorg verifies that the block is the child of the last processed one.
+// If not, the processed blocks no longer in the chain are rolled back.
+func (e *ScanEventDispatcher) checkReorg(number uint64, parentHash common.Hash) (bool, error) {
+
+	if len(e.history) == 0 {
+		return false, nil
+	}
+	last := e.history[len(e.history)-1]
+	if last.Number+1 != number || last.Hash == parentHash {
+		return false, nil
+	}
+
+	log.WithField("block", number).Warn("EVENT chain reorganization detected")
+
+	return true, e.rollback()
+}
+
+// rollback notifies the handlers of the reverted events of the processed
+// blocks that are no longer in the chain, and moves the savepoint back to the
+// fork point.
+func (e *ScanEventDispatcher) rollback() error {
+
+	var fork uint64
+	if e.history[0].Number > 0 {
+		fork = e.history[0].Number - 1
+	}
+	for len(e.history) > 0 {
+		last := e.history[len(e.history)-1]
+		header, err := e.client.HeaderByNumber(context.TODO(), new(big.Int).SetUint64(last.Number))
+		if err != nil && err != ethereum.NotFound {
+			return err
+		}
+		if err == nil && header.Hash() == last.Hash {
+			fork = last.Number
+			break
 		}
-		e.Unlock()
 
-		if handler != nil {
-			log.WithField("event", handler.EventName).Debug("EVENT run handler ")
-			return handler.Handler(logevent, handler)
+		log.WithField("block", last.Number).Warn("EVENT reverting orphaned block")
+		for i := len(last.Logs) - 1; i >= 0; i-- {
+			reverted := *last.Logs[i]
+			reverted.Removed = true
+			if err := e.runHandlerFor(&reverted); err != nil {
+				return err
+			}
 		}
+		e.history = e.history[:len(e.history)-1]
 	}
 
+	if len(e.history) == 0 {
+		log.WithError(errReorgTooDeep).Warn("EVENT older events cannot be reverted")
+	}
+
+	if err := e.saveHistory(); err != nil {
+		return err
+	}
+	if err := e.savepoint.SaveBlock(fork); err != nil {
+		return err
+	}
+	e.nextBlock, e.nextTxIndex, e.nextLogIndex = fork+1, 0, 0
+	e.block = nil
+	e.blockLogs = nil
+
 	return nil
 }
 
-func (e *ScanEventDispatcher) process() (bool, error) {
+// load retrieves the last processed log and the history of processed blocks,
+// this is only called in the first loop.
+func (e *ScanEventDispatcher) load() error {
 
 	var err error
 
-	// Retrieve the last processed log, this is only called in the first loop.
 	if e.nextBlock == 0 {
 		e.nextBlock, e.nextTxIndex, e.nextLogIndex, err = e.savepoint.Load()
 		if err != nil {
-			return false, err
+			return err
 		}
 		e.nextLogIndex++
+		return e.loadHistory()
+	}
+	return nil
+}
+
+func (e *ScanEventDispatcher) process() (bool, error) {
+
+	var err error
+
+	if err = e.load(); err != nil {
+		return false, err
 	}
 
 	log.WithFields(log.Fields{
@@ -146,7 +375,13 @@ func (e *ScanEventDispatcher) process() (bool, error) {
 
 	// Check if e.block is valid, if not download it.
 	if e.block == nil || e.block.NumberU64() < e.nextBlock {
-		e.block, err = e.client.BlockByNumber(context.TODO(), big.NewInt(int64(e.nextBlock)))
+
+		// Check if block has enough confirmations.
+		if confirmed, err := e.confirmed(e.nextBlock); err != nil || !confirmed {
+			return err == nil, err
+		}
+
+		block, err := e.client.BlockByNumber(context.TODO(), big.NewInt(int64(e.nextBlock)))
 
 		// Check if block is available, if is in the main chain.
 		if err == ethereum.NotFound {
@@ -156,6 +391,12 @@ func (e *ScanEventDispatcher) process() (bool, error) {
 			return false, err
 		}
 
+		// Check if the chain has been reorganized.
+		if reorg, err := e.checkReorg(block.NumberU64(), block.ParentHash()); err != nil || reorg {
+			return false, err
+		}
+		e.block = block
+
 		// Download all receipts, starting with the last processed one,
 		//   transactions marked as skip, are not processed
 		for index := e.nextTxIndex; index < uint(len(e.block.Transactions())); index++ {
@@ -179,6 +420,9 @@ func (e *ScanEventDispatcher) process() (bool, error) {
 			if !skip {
 				receipt, err = e.receipts.Get(txid)
 				if err != nil {
+					// request it again for the next retry
+					e.receipts.Forget(txid)
+					e.receipts.Request(txid)
 					return false, err
 				}
 			}
@@ -201,6 +445,7 @@ func (e *ScanEventDispatcher) process() (bool, error) {
 			return false, err
 		}
 
+		e.blockLogs = append(e.blockLogs, logevent)
 		e.savepoint.Save(logevent)
 		e.nextLogIndex++
 	}
@@ -216,6 +461,9 @@ func (e *ScanEventDispatcher) process() (bool, error) {
 	}
 
 	if e.nextTxIndex >= uint(len(e.block.Transactions())) {
+		if err := e.processed(e.block.NumberU64(), e.block.Hash()); err != nil {
+			return false, err
+		}
 		e.nextLogIndex = 0
 		e.nextTxIndex = 0
 		e.nextBlock++
@@ -226,9 +474,9 @@ func (e *ScanEventDispatcher) process() (bool, error) {
 
 // Stop scanning the blockchain for events
 func (e *ScanEventDispatcher) Stop() {
-	go func() {
-		e.terminatech <- nil
-	}()
+	e.stopOnce.Do(func() {
+		close(e.terminatech)
+	})
 }
 
 // Join waits all background jobs finished
@@ -236,33 +484,105 @@ func (e *ScanEventDispatcher) Join() {
 	<-e.terminatedch
 }
 
+// Done returns a channel that is closed when scanning has finished.
+func (e *ScanEventDispatcher) Done() <-chan interface{} {
+	return e.terminatedch
+}
+
+// Status returns the status of the scanning.
+func (e *ScanEventDispatcher) Status() ScanStatus {
+	e.Lock()
+	defer e.Unlock()
+	return e.status
+}
+
+// failed records that scanning failed with err, and is retried after delay.
+func (e *ScanEventDispatcher) failed(err error, delay time.Duration) {
+	e.Lock()
+	e.status.Failures++
+	e.status.LastError = err.Error()
+	e.status.NextRetry = time.Now().Add(delay)
+	failures := e.status.Failures
+	e.Unlock()
+
+	log.WithError(err).WithFields(log.Fields{
+		"failures": failures,
+		"delay":    delay,
+	}).Warn("EVENT scanning failed, retrying")
+}
+
+// succeeded records that scanning works again after failing.
+func (e *ScanEventDispatcher) succeeded() {
+	e.Lock()
+	defer e.Unlock()
+	if e.status.Failures > 0 {
+		log.WithField("failures", e.status.Failures).Info("EVENT scanning recovered")
+		e.status = ScanStatus{}
+	}
+}
+
+// sleep waits for delay, returns false if stopped meanwhile.
+func (e *ScanEventDispatcher) sleep(delay time.Duration) bool {
+	select {
+	case <-e.terminatech:
+		log.Debug("EVENT Dispatching terminatech")
+		return false
+	case <-time.After(delay):
+		return true
+	}
+}
+
 // Start scanning the blockchain for events
 func (e *ScanEventDispatcher) Start() {
 
 	go func() {
 		e.receipts.Start()
-		loop := true
-		for loop {
-			select {
-
-			case <-e.terminatech:
-				log.Debug("EVENT Dispatching terminatech")
-				loop = false
-				break
-
-			default:
-				wait, err := e.process()
-				if err != nil {
-					log.Error("EVENT Failed ", err)
-					loop = false
-				} else if wait {
-					time.Sleep(4 * time.Second)
-				}
-			}
+		if e.Mode == ScanSubscribe {
+			e.subscribe()
+		} else {
+			e.poll()
 		}
-		e.terminatedch <- nil
 		e.receipts.Stop()
 		e.receipts.Join()
+		close(e.terminatedch)
 
 	}()
 }
+
+// poll scans the blockchain until stopped, when it fails it is retried with
+// an exponential backoff
+func (e *ScanEventDispatcher) poll() {
+
+	process := e.process
+	if e.Mode == ScanLogs {
+		process = e.processLogs
+	}
+
+	delay := minReconnectDelay
+	for {
+		select {
+
+		case <-e.terminatech:
+			log.Debug("EVENT Dispatching terminatech")
+			return
+
+		default:
+			wait, err := process()
+			if err != nil {
+				e.failed(err, delay)
+				if !e.sleep(delay) {
+					return
+				}
+				if delay *= 2; delay > maxReconnectDelay {
+					delay = maxReconnectDelay
+				}
+				continue
+			}
+			e.succeeded()
+			delay = minReconnectDelay
+			if wait && !e.sleep(4*time.Second) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,345 @@
+package eth
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/assert"
+)
+
+const testAbi = `[{"anonymous":false,"inputs":[],"name":"Changed","type":"event"}]`
+
+var (
+	testAddress = common.HexToAddress("0x5ffc014343cd971b7eb70732021e26c35b744cc4")
+	testTopic   = crypto.Keccak256Hash([]byte("Changed()"))
+)
+
+// testChain is an in-process node with the methods used by the dispatcher,
+// whose blocks can be replaced to simulate reorganizations.
+type testChain struct {
+	sync.Mutex
+	blocks []testBlock
+
+	// maxRange makes the logs queries of more blocks fail with too many
+	//   results, ranges are the queries done
+	maxRange uint64
+	ranges   [][2]uint64
+
+	// failLogs is the number of next logs queries that fail
+	failLogs int
+
+	// subscriptions to the logs
+	subs []testSub
+}
+
+type testBlock struct {
+	header json.RawMessage
+	hash   common.Hash
+	logs   []types.Log
+}
+
+func newTestChain(t *testing.T, blocks int) *testChain {
+	c := &testChain{}
+	c.fork(t, 0, blocks, 0)
+	return c
+}
+
+// fork replaces the blocks from number with n new ones, tagged so they have
+// other hashes.
+func (c *testChain) fork(t *testing.T, number uint64, n int, tag byte) {
+	c.Lock()
+	defer c.Unlock()
+
+	zero := common.Hash{}.Hex()
+	c.blocks = c.blocks[:number]
+	for i := 0; i < n; i++ {
+		var parent common.Hash
+		if len(c.blocks) > 0 {
+			parent = c.blocks[len(c.blocks)-1].hash
+		}
+		number := hexutil.EncodeUint64(uint64(len(c.blocks)))
+		header := fmt.Sprintf(`{"parentHash":"%v","sha3Uncles":"%v","miner":"%v",`+
+			`"stateRoot":"%v","transactionsRoot":"%v","receiptsRoot":"%v","logsBloom":"0x%v",`+
+			`"difficulty":"0x1","number":"%v","gasLimit":"0x0","gasUsed":"0x0","timestamp":"%v",`+
+			`"extraData":"0x%02x","mixHash":"%v","nonce":"0x0000000000000000"}`,
+			parent.Hex(), zero, common.Address{}.Hex(), zero, zero, zero, strings.Repeat("00", 256),
+			number, number, tag, zero)
+
+		var h types.Header
+		assert.Nil(t, json.Unmarshal([]byte(header), &h))
+		c.blocks = append(c.blocks, testBlock{header: json.RawMessage(header), hash: h.Hash()})
+	}
+}
+
+// addLog adds an event of the test contract to a block.
+func (c *testChain) addLog(number uint64) types.Log {
+	c.Lock()
+	defer c.Unlock()
+
+	block := &c.blocks[number]
+	logevent := types.Log{
+		Address:     testAddress,
+		Topics:      []common.Hash{testTopic},
+		Data:        []byte{},
+		BlockNumber: number,
+		TxHash:      crypto.Keccak256Hash(block.hash[:], []byte{byte(len(block.logs))}),
+		TxIndex:     uint(len(block.logs)),
+		BlockHash:   block.hash,
+		Index:       uint(len(block.logs)),
+	}
+	block.logs = append(block.logs, logevent)
+	return logevent
+}
+
+func (c *testChain) server(t *testing.T) *rpc.Server {
+	server := rpc.NewServer()
+	assert.Nil(t, server.RegisterName("eth", &ChainAPI{c}))
+	return server
+}
+
+func (c *testChain) client(t *testing.T) *ethclient.Client {
+	return ethclient.NewClient(rpc.DialInProc(c.server(t)))
+}
+
+// ChainAPI are the eth_ methods of the test chain, exported to be served.
+type ChainAPI struct {
+	chain *testChain
+}
+
+func (api *ChainAPI) number(number string) (uint64, error) {
+	if number == "latest" {
+		return uint64(len(api.chain.blocks) - 1), nil
+	}
+	return hexutil.DecodeUint64(number)
+}
+
+func (api *ChainAPI) GetBlockByNumber(number string, full bool) (json.RawMessage, error) {
+	api.chain.Lock()
+	defer api.chain.Unlock()
+
+	n, err := api.number(number)
+	if err != nil {
+		return nil, err
+	}
+	if n >= uint64(len(api.chain.blocks)) {
+		return nil, nil
+	}
+	return api.chain.blocks[n].header, nil
+}
+
+type LogFilter struct {
+	FromBlock string `json:"fromBlock"`
+	ToBlock   string `json:"toBlock"`
+}
+
+func (api *ChainAPI) GetLogs(filter LogFilter) ([]types.Log, error) {
+	api.chain.Lock()
+	defer api.chain.Unlock()
+
+	from, err := api.number(filter.FromBlock)
+	if err != nil {
+		return nil, err
+	}
+	to, err := api.number(filter.ToBlock)
+	if err != nil {
+		return nil, err
+	}
+	api.chain.ranges = append(api.chain.ranges, [2]uint64{from, to})
+	if api.chain.failLogs > 0 {
+		api.chain.failLogs--
+		return nil, errors.New("node unavailable")
+	}
+	if api.chain.maxRange > 0 && to-from+1 > api.chain.maxRange {
+		return nil, errors.New("query returned more than 10000 results")
+	}
+
+	logs := []types.Log{}
+	for n := from; n <= to && n < uint64(len(api.chain.blocks)); n++ {
+		logs = append(logs, api.chain.blocks[n].logs...)
+	}
+	return logs, nil
+}
+
+// historySavePoint is a MemorySavePoint that also keeps the history of
+// processed blocks, like a persisted savepoint.
+type historySavePoint struct {
+	*MemorySavePoint
+	history []ProcessedBlock
+}
+
+func (p *historySavePoint) LoadHistory() ([]ProcessedBlock, error) {
+	return p.history, nil
+}
+
+func (p *historySavePoint) SaveHistory(history []ProcessedBlock) error {
+	p.history = append([]ProcessedBlock{}, history...)
+	return nil
+}
+
+// testHandled records the events handled, as their block number, negative
+// if removed.
+type testHandled struct {
+	sync.Mutex
+	blocks []int
+}
+
+func (h *testHandled) handle(logevent *types.Log, handler *ScanEventHandler) error {
+	h.Lock()
+	defer h.Unlock()
+
+	block := int(logevent.BlockNumber)
+	if logevent.Removed {
+		block = -block
+	}
+	h.blocks = append(h.blocks, block)
+	return nil
+}
+
+func (h *testHandled) handled() []int {
+	h.Lock()
+	defer h.Unlock()
+	return append([]int{}, h.blocks...)
+}
+
+// newTestDispatcher creates a dispatcher in logs mode that filters a block
+// at once, with a handler for the events of the test contract.
+func newTestDispatcher(t *testing.T, chain *testChain, savepoint SavePoint, handled *testHandled) *ScanEventDispatcher {
+	contractabi, err := abi.JSON(bytes.NewReader([]byte(testAbi)))
+	assert.Nil(t, err)
+
+	e := NewScanEventDispatcher(chain.client(t), savepoint)
+	e.Mode = ScanLogs
+	e.MaxLogsRange = 1
+	e.logsRange = 1
+	e.RegisterHandler(testAddress, &contractabi, "Changed", handled.handle, nil)
+	return e
+}
+
+// scanAll processes the logs until the head of the chain.
+func scanAll(t *testing.T, e *ScanEventDispatcher) {
+	for i := 0; i < 1000; i++ {
+		wait, err := e.processLogs()
+		assert.Nil(t, err)
+		if err != nil || wait {
+			return
+		}
+	}
+	t.Fatal("scanning did not reach the head")
+}
+
+func TestReorgRollback(t *testing.T) {
+	chain := newTestChain(t, 11)
+	chain.addLog(5)
+	chain.addLog(8)
+
+	savepoint := NewMemorySavePoint(1)
+	handled := &testHandled{}
+	e := newTestDispatcher(t, chain, savepoint, handled)
+
+	scanAll(t, e)
+	assert.Equal(t, []int{5, 8}, handled.handled())
+
+	// blocks 7 to 10 are replaced by 7 to 11
+	chain.fork(t, 7, 5, 1)
+	chain.addLog(9)
+
+	// the reorg is detected with block 11, the events of the orphaned blocks
+	//   are reverted, and the savepoint rolled back to the fork point
+	wait, err := e.processLogs()
+	assert.Nil(t, err)
+	assert.False(t, wait)
+	assert.Equal(t, []int{5, 8, -8}, handled.handled())
+	block, _, _, err := savepoint.Load()
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(6), block)
+
+	scanAll(t, e)
+	assert.Equal(t, []int{5, 8, -8, 9}, handled.handled())
+	block, _, _, err = savepoint.Load()
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(11), block)
+}
+
+func TestReorgWhileStopped(t *testing.T) {
+	chain := newTestChain(t, 11)
+	chain.addLog(8)
+
+	savepoint := &historySavePoint{MemorySavePoint: NewMemorySavePoint(1)}
+	handled := &testHandled{}
+	scanAll(t, newTestDispatcher(t, chain, savepoint, handled))
+	assert.Equal(t, []int{8}, handled.handled())
+	assert.Equal(t, uint64(10), savepoint.history[len(savepoint.history)-1].Number)
+
+	chain.fork(t, 7, 4, 1)
+
+	// a new dispatcher checks the persisted history when it starts
+	e := newTestDispatcher(t, chain, savepoint, handled)
+	wait, err := e.processLogs()
+	assert.Nil(t, err)
+	assert.False(t, wait)
+	assert.Equal(t, []int{8, -8}, handled.handled())
+
+	scanAll(t, e)
+	assert.Equal(t, []int{8, -8}, handled.handled())
+	block, _, _, err := savepoint.Load()
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(10), block)
+}
+
+func TestPollRetry(t *testing.T) {
+	chain := newTestChain(t, 11)
+	chain.addLog(5)
+	chain.failLogs = 1
+
+	handled := &testHandled{}
+	e := newTestDispatcher(t, chain, NewMemorySavePoint(1), handled)
+	e.Start()
+	defer func() {
+		e.Stop()
+		e.Join()
+	}()
+
+	// the dispatcher does not exit when a query fails, it is retried later
+	for start := time.Now(); e.Status().Failures == 0 && time.Since(start) < 10*time.Second; {
+		time.Sleep(10 * time.Millisecond)
+	}
+	status := e.Status()
+	assert.Equal(t, 1, status.Failures)
+	assert.Equal(t, "node unavailable", status.LastError)
+
+	waitHandled(t, handled, []int{5})
+	for start := time.Now(); e.Status().Failures > 0 && time.Since(start) < 10*time.Second; {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, ScanStatus{}, e.Status())
+}
+
+func TestStopStopped(t *testing.T) {
+	chain := newTestChain(t, 1)
+	e := newTestDispatcher(t, chain, NewMemorySavePoint(1), &testHandled{})
+	e.Start()
+	e.Stop()
+	e.Join()
+
+	// stopping again does not block nor leave goroutines waiting
+	e.Stop()
+	e.Join()
+	select {
+	case <-e.Done():
+	default:
+		t.Fatal("dispatcher not done")
+	}
+}
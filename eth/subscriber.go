@@ -0,0 +1,177 @@
+package eth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// minReconnectDelay and maxReconnectDelay bound the exponential backoff
+	//   between subscription reconnections and retries of failed scans
+	minReconnectDelay = time.Second
+	maxReconnectDelay = time.Minute
+)
+
+var (
+	errTerminated      = errors.New("dispatcher terminated")
+	errHandlersChanged = errors.New("event handlers changed")
+)
+
+func (e *ScanEventDispatcher) version() int {
+	e.Lock()
+	defer e.Unlock()
+	return e.handlersVersion
+}
+
+// subscribe receives events from a subscription until stopped, reconnecting
+// when the subscription fails and backfilling the gap with ScanLogs.
+func (e *ScanEventDispatcher) subscribe() {
+
+	delay := minReconnectDelay
+	for {
+		backfilled, err := e.subscribeOnce()
+		if err == errTerminated {
+			return
+		}
+		if backfilled {
+			e.succeeded()
+			delay = minReconnectDelay
+		}
+		if err == errHandlersChanged {
+			log.Debug("EVENT resubscribing, handlers changed")
+			continue
+		}
+
+		e.failed(err, delay)
+		if !e.sleep(delay) {
+			return
+		}
+		if delay *= 2; delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
+
+// subscribeOnce subscribes to the logs of the registered handlers, backfills
+// the blocks since the savepoint up to the head, and handles the received
+// logs.
+func (e *ScanEventDispatcher) subscribeOnce() (backfilled bool, err error) {
+
+	version := e.version()
+	ticker := time.NewTicker(4 * time.Second)
+	defer ticker.Stop()
+
+	query := e.filterQuery(0, 0)
+	query.FromBlock, query.ToBlock = nil, nil
+
+	logsch := make(chan types.Log, 128)
+	var errch <-chan error
+
+	if len(query.Addresses) > 0 {
+		client, err := ethclient.Dial(e.SubscribeURL)
+		if err != nil {
+			return false, err
+		}
+		defer client.Close()
+
+		sub, err := client.SubscribeFilterLogs(context.Background(), query, logsch)
+		if err != nil {
+			return false, err
+		}
+		defer sub.Unsubscribe()
+		errch = sub.Err()
+
+		log.WithField("url", e.SubscribeURL).Info("EVENT subscribed to logs")
+	}
+
+	// Backfill up to the head, since the subscription only receives the logs
+	//   of new blocks and they are not confirmed either. Received logs are
+	//   buffered meanwhile, and the ones already backfilled are discarded
+	for wait := false; !wait; {
+		select {
+		case <-e.terminatech:
+			return false, errTerminated
+		default:
+		}
+		if wait, err = e.filterLogs(0); err != nil {
+			return false, err
+		}
+	}
+
+	for {
+		select {
+
+		case <-e.terminatech:
+			log.Debug("EVENT Dispatching terminatech")
+			return true, errTerminated
+
+		case err := <-errch:
+			return true, err
+
+		case logevent := <-logsch:
+			if err := e.processLive(&logevent); err != nil {
+				return true, err
+			}
+
+		case <-ticker.C:
+			if e.version() != version {
+				return true, errHandlersChanged
+			}
+		}
+	}
+}
+
+// processLive handles a log received from the subscription. Logs removed by a
+// chain reorganization are notified to the handlers, and scanning resumes at
+// their block.
+func (e *ScanEventDispatcher) processLive(logevent *types.Log) error {
+
+	// transactions marked as skip are not processed
+	skip, err := e.savepoint.SkipTx(logevent.TxHash)
+	if err != nil {
+		return err
+	}
+
+	if logevent.Removed {
+		if !skip {
+			if err := e.runHandlerFor(logevent); err != nil {
+				return err
+			}
+		}
+		var block uint64
+		if logevent.BlockNumber > 0 {
+			block = logevent.BlockNumber - 1
+		}
+		e.nextBlock, e.nextTxIndex, e.nextLogIndex = block+1, 0, 0
+		e.history = nil
+		if err := e.saveHistory(); err != nil {
+			return err
+		}
+		return e.savepoint.SaveBlock(block)
+	}
+
+	if skip || e.alreadyProcessed(logevent) {
+		return nil
+	}
+	if err := e.runHandlerFor(logevent); err != nil {
+		log.WithFields(log.Fields{
+			"err":  err,
+			"txid": logevent.TxHash.Hex(),
+		}).Warn("EVENT Failed handling ")
+		return err
+	}
+	e.nextBlock, e.nextTxIndex, e.nextLogIndex = logevent.BlockNumber, logevent.TxIndex, logevent.Index+1
+	if len(e.history) > 0 {
+		e.history = nil
+		if err := e.saveHistory(); err != nil {
+			return err
+		}
+	}
+	return e.savepoint.Save(logevent)
+}
@@ -0,0 +1,162 @@
+package eth
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/assert"
+)
+
+type testSub struct {
+	notifier *rpc.Notifier
+	id       rpc.ID
+}
+
+// Logs is the logs subscription of the test chain.
+func (api *ChainAPI) Logs(ctx context.Context, filter LogFilter) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return nil, rpc.ErrNotificationsUnsupported
+	}
+	sub := notifier.CreateSubscription()
+
+	api.chain.Lock()
+	api.chain.subs = append(api.chain.subs, testSub{notifier, sub.ID})
+	api.chain.Unlock()
+	return sub, nil
+}
+
+// notify sends a log to the subscriptions.
+func (c *testChain) notify(logevent types.Log) {
+	c.Lock()
+	defer c.Unlock()
+	for _, sub := range c.subs {
+		sub.notifier.Notify(sub.id, logevent)
+	}
+}
+
+// testListener is a listener that can close the accepted connections.
+type testListener struct {
+	net.Listener
+	sync.Mutex
+	conns []net.Conn
+}
+
+func (l *testListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		l.Lock()
+		l.conns = append(l.conns, conn)
+		l.Unlock()
+	}
+	return conn, err
+}
+
+func (l *testListener) closeConns() {
+	l.Lock()
+	defer l.Unlock()
+	for _, conn := range l.conns {
+		conn.Close()
+	}
+	l.conns = nil
+}
+
+// waitHandled waits until the handled events are the expected ones.
+func waitHandled(t *testing.T, handled *testHandled, expected []int) {
+	for start := time.Now(); time.Since(start) < 10*time.Second; {
+		if assert.ObjectsAreEqual(expected, handled.handled()) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, expected, handled.handled())
+}
+
+func TestSubscribe(t *testing.T) {
+	chain := newTestChain(t, 11)
+	chain.addLog(5)
+	chain.addLog(9)
+
+	ws := httptest.NewUnstartedServer(chain.server(t).WebsocketHandler([]string{"*"}))
+	listener := &testListener{Listener: ws.Listener}
+	ws.Listener = listener
+	ws.Start()
+	defer ws.Close()
+
+	savepoint := NewMemorySavePoint(1)
+	handled := &testHandled{}
+	e := newTestDispatcher(t, chain, savepoint, handled)
+	e.Mode = ScanSubscribe
+	e.SubscribeURL = "ws://" + ws.Listener.Addr().String()
+	e.ConfirmationDepth = 3
+
+	e.Start()
+	defer func() {
+		e.Stop()
+		e.Join()
+	}()
+
+	// the backfill reaches the head, the logs in the blocks not confirmed
+	//   are not lost since the subscription only receives new ones
+	waitHandled(t, handled, []int{5, 9})
+
+	// the next logs are received from the subscription
+	chain.fork(t, 11, 1, 0)
+	chain.notify(chain.addLog(11))
+	waitHandled(t, handled, []int{5, 9, 11})
+	for start := time.Now(); time.Since(start) < 10*time.Second; {
+		if block, _, _, _ := savepoint.Load(); block == 11 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	block, _, _, err := savepoint.Load()
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(11), block)
+
+	// the logs emitted while disconnected are backfilled when resubscribed
+	listener.closeConns()
+	chain.fork(t, 12, 1, 0)
+	chain.addLog(12)
+	waitHandled(t, handled, []int{5, 9, 11, 12})
+}
+
+func TestSubscribeSkipTx(t *testing.T) {
+	chain := newTestChain(t, 11)
+	chain.addLog(5)
+
+	ws := httptest.NewServer(chain.server(t).WebsocketHandler([]string{"*"}))
+	defer ws.Close()
+
+	savepoint := &skipSavePoint{
+		MemorySavePoint: NewMemorySavePoint(1),
+		skip:            map[common.Hash]bool{},
+	}
+	handled := &testHandled{}
+	e := newTestDispatcher(t, chain, savepoint, handled)
+	e.Mode = ScanSubscribe
+	e.SubscribeURL = "ws://" + ws.Listener.Addr().String()
+
+	e.Start()
+	defer func() {
+		e.Stop()
+		e.Join()
+	}()
+	waitHandled(t, handled, []int{5})
+
+	// the logs received from the subscription are also skipped
+	chain.fork(t, 11, 1, 0)
+	skipped := chain.addLog(11)
+	savepoint.skipTx(skipped.TxHash)
+	chain.notify(skipped)
+	chain.fork(t, 12, 1, 0)
+	chain.notify(chain.addLog(12))
+	waitHandled(t, handled, []int{5, 12})
+}
@@ -79,6 +79,20 @@ func (w *Web3Client) BalanceInfo() (string, error) {
 	return balance.String(), nil
 }
 
+// NonceInfo returns the nonce of the account in the last block, and
+// including the pending transactions
+func (w *Web3Client) NonceInfo() (nonce, pending uint64, err error) {
+
+	ctx := context.TODO()
+	if nonce, err = w.Client.NonceAt(ctx, w.Account.Address, nil); err != nil {
+		return 0, 0, err
+	}
+	if pending, err = w.Client.PendingNonceAt(ctx, w.Account.Address); err != nil {
+		return 0, 0, err
+	}
+	return nonce, pending, nil
+}
+
 // SendTransactionSync executes a contract method and wait it finalizes
 func (w *Web3Client) SendTransactionSync(to *common.Address, value *big.Int, gasLimit uint64, calldata []byte) (*types.Transaction, *types.Receipt, error) {
 
@@ -188,8 +202,17 @@ func (w *Web3Client) SendTransactionSync(to *common.Address, value *big.Int, gas
 
 // Call an constant method
 func (w *Web3Client) Call(to *common.Address, value *big.Int, calldata []byte) ([]byte, error) {
+	return w.CallContext(context.TODO(), to, value, calldata)
+}
 
-	ctx := context.TODO()
+// CallContext calls a constant method, that is cancelled with ctx.
+func (w *Web3Client) CallContext(ctx context.Context, to *common.Address, value *big.Int, calldata []byte) ([]byte, error) {
+	return w.CallContextAt(ctx, to, value, calldata, nil)
+}
+
+// CallContextAt calls a constant method on the state of a block, the last one
+// if block is nil.
+func (w *Web3Client) CallContextAt(ctx context.Context, to *common.Address, value *big.Int, calldata []byte, block *big.Int) ([]byte, error) {
 
 	msg := ethereum.CallMsg{
 		From:  w.Account.Address,
@@ -198,7 +221,7 @@ func (w *Web3Client) Call(to *common.Address, value *big.Int, calldata []byte) (
 		Data:  calldata,
 	}
 
-	return w.Client.CallContract(ctx, msg, nil)
+	return w.Client.CallContract(ctx, msg, block)
 }
 
 // Do a web3 signature
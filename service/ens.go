@@ -2,6 +2,7 @@ package service
 
 import (
 	"bytes"
+	"context"
 	"strings"
 
 	"github.com/ethereum/go-ethereum/accounts/abi"
@@ -51,8 +52,10 @@ func NameHash(name string) common.Hash {
 
 type ENSClient interface {
 	Info(name string) (string, error)
-	Text(name, key string) (string, error)
+	Resolver(ctx context.Context, name string) (common.Address, error)
+	Text(ctx context.Context, name, key string) (string, error)
 	SetText(name, key, text string) error
+	BlockNumber(ctx context.Context) (uint64, error)
 }
 
 type ENSClientImpl struct {
@@ -94,22 +97,43 @@ func (e *ENSClientImpl) Info(name string) (string, error) {
 	return info, nil
 }
 
-func (e *ENSClientImpl) Text(name, key string) (string, error) {
+func (e *ENSClientImpl) Resolver(ctx context.Context, name string) (common.Address, error) {
 
 	namehash := NameHash(name)
 
 	var addr common.Address
-	if err := e.root.Call(&addr, "resolver", namehash); err != nil {
-		return "", err
+	if err := e.root.CallContext(ctx, &addr, "resolver", namehash); err != nil {
+		return addr, err
 	}
 	log.Debug("ENS ", name, " key is ", namehash.Hex(), " => resolver ", addr.Hex())
+	return addr, nil
+}
+
+// BlockNumber returns the number of the last block.
+func (e *ENSClientImpl) BlockNumber(ctx context.Context) (uint64, error) {
+
+	header, err := e.root.Client().Client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	return header.Number.Uint64(), nil
+}
+
+func (e *ENSClientImpl) Text(ctx context.Context, name, key string) (string, error) {
+
+	namehash := NameHash(name)
+
+	addr, err := e.Resolver(ctx, name)
+	if err != nil {
+		return "", err
+	}
 	resolver, err := eth.NewContract(e.root.Client(), &e.resolver, nil, &addr)
 	if err != nil {
 		return "", err
 	}
 
 	var text string
-	if err := resolver.Call(&text, "text", namehash, key); err != nil {
+	if err := resolver.CallContext(ctx, &text, "text", namehash, key); err != nil {
 		return "", err
 	}
 
@@ -2,6 +2,7 @@ package service
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -42,8 +43,9 @@ const (
 )
 
 type Ipfsc struct {
-	ipfs IPFSClient
-	ens  ENSClient
+	ipfs     IPFSClient
+	ens      ENSClient
+	registry RegistryClient
 }
 
 type IPFSClient interface {
@@ -81,34 +83,68 @@ func parse(data []byte) (interface{}, error) {
 	return nil, fmt.Errorf("Uknown manifest type %v", cfg.Type)
 }
 
-func NewIPFSCClient(ipfs IPFSClient, ens ENSClient) *Ipfsc {
-	return &Ipfsc{ipfs, ens}
+func NewIPFSCClient(ipfs IPFSClient, ens ENSClient, registry RegistryClient) *Ipfsc {
+	return &Ipfsc{ipfs, ens, registry}
 }
 
 func (i *Ipfsc) Read(ensname string) (interface{}, error) {
 
 	log.WithField("ensname", ensname).Info("Reading IPFS key from ENS")
-	ipfshash, err := i.ens.Text(ensname, DefaultManifestKey)
+	ctx := context.Background()
+	ipfshash, err := i.ens.Text(ctx, ensname, DefaultManifestKey)
 	if err != nil {
 		return nil, err
 	}
 
-	log.WithField("hash", ipfshash).Info("Downloading manifest")
-	reader, err := i.ipfs.Cat(ipfshash)
+	data, err := i.Fetch(ctx, ipfshash)
 	if err != nil {
 		return nil, err
 	}
-	data, err := ioutil.ReadAll(reader)
+	manifest, err := parse(data)
 	if err != nil {
 		return nil, err
 	}
-	log.WithField("hash", ipfshash).Debug("Manifest downloaded")
-	manifest, err := parse(data)
+
+	return manifest, nil
+}
+
+// Fetch downloads the manifest stored in ipfshash. If ctx is cancelled it
+// returns without waiting for the download.
+func (i *Ipfsc) Fetch(ctx context.Context, ipfshash string) ([]byte, error) {
+
+	type result struct {
+		data []byte
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		data, err := i.fetch(ipfshash)
+		done <- result{data, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.data, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (i *Ipfsc) fetch(ipfshash string) ([]byte, error) {
+
+	log.WithField("hash", ipfshash).Info("Downloading manifest")
+	reader, err := i.ipfs.Cat(ipfshash)
 	if err != nil {
 		return nil, err
 	}
+	defer reader.Close()
 
-	return manifest, nil
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	log.WithField("hash", ipfshash).Debug("Manifest downloaded")
+	return data, nil
 }
 
 func (i *Ipfsc) WritePinningManifest(ensname string, manifest *PinningManifest) error {
@@ -162,3 +198,7 @@ func (i *Ipfsc) IPFS() IPFSClient {
 func (i *Ipfsc) ENS() ENSClient {
 	return i.ens
 }
+
+func (i *Ipfsc) Registry() RegistryClient {
+	return i.registry
+}
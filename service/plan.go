@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"strings"
+)
+
+const (
+	// PlanPin, PlanKeep, PlanQuarantine and PlanUnpin are the actions of a
+	// sync plan
+	PlanPin        = "pin"
+	PlanKeep       = "keep"
+	PlanQuarantine = "quarantine"
+	PlanUnpin      = "unpin"
+)
+
+// PlanEntry is a hash that a sync would pin, keep, keep pending removal or
+// unpin, with the path that reaches it.
+type PlanEntry struct {
+	Action string `json:"action"`
+	Hash   string `json:"hash"`
+	Size   uint64 `json:"size"`
+	Path   string `json:"path"`
+}
+
+// PlanMember is the size that a sync would charge to a consortium member,
+// and the status of its quota.
+type PlanMember struct {
+	Name     string `json:"name"`
+	Quotum   string `json:"quotum"`
+	Used     uint64 `json:"used"`
+	Rejected uint64 `json:"rejected"`
+	Exceeded bool   `json:"exceeded"`
+}
+
+// SyncPlan is what a sync would do, as returned by Plan.
+type SyncPlan struct {
+	Entries []PlanEntry  `json:"entries"`
+	Members []PlanMember `json:"members"`
+	Stats   ServiceStats `json:"stats"`
+}
+
+// dryIPFS is an IPFS client that reads objects, but does not pin or unpin.
+type dryIPFS struct {
+	IPFSClient
+}
+
+func (dryIPFS) Pin(path string, recursive bool) error {
+	return nil
+}
+
+func (dryIPFS) Unpin(path string) error {
+	return nil
+}
+
+// ipfs returns the IPFS client to pin and unpin, that does nothing when
+// planning.
+func (s *Service) ipfs() IPFSClient {
+	if s.plan != nil {
+		return dryIPFS{s.ipfsc.IPFS()}
+	}
+	return s.ipfsc.IPFS()
+}
+
+// record adds a hash to the plan if planning, with the path that reaches it
+// ended with its parent object if any.
+func (s *Service) record(action, hash, path, parent string, size uint64) {
+	if s.plan == nil || s.recorded[hash] {
+		return
+	}
+	s.recorded[hash] = true
+
+	if parent != "" && !strings.HasSuffix(path, ">"+parent) {
+		path += ">" + parent
+	}
+	s.plan.Entries = append(s.plan.Entries, PlanEntry{
+		Action: action,
+		Hash:   hash,
+		Size:   size,
+		Path:   path,
+	})
+}
+
+// Plan resolves the roots like Sync, but without pinning, unpinning or
+// writing to the db, and returns what the sync would do. The plan runs on a
+// copy of the service, so the state kept between syncs is not changed, but
+// the db cannot be written meanwhile.
+func (s *Service) Plan(ctx context.Context, ensnames []string) (*SyncPlan, error) {
+
+	dry, err := s.storage.DryRun()
+	if err != nil {
+		return nil, err
+	}
+	defer dry.Discard()
+
+	p := NewService(s.ipfsc, dry)
+	p.MaxDepth = s.MaxDepth
+	p.PinMode = s.PinMode
+	p.Workers = s.Workers
+	p.RetryDelay = s.RetryDelay
+	p.MaxRetryDelay = s.MaxRetryDelay
+	p.MaxRetries = s.MaxRetries
+	p.GraceSyncs = s.GraceSyncs
+	p.GracePeriod = s.GracePeriod
+	p.plan = &SyncPlan{}
+	p.recorded = make(map[string]bool)
+
+	stats, err := p.Sync(ctx, ensnames)
+
+	plan := p.plan
+	plan.Stats = stats
+	for _, q := range p.quotas {
+		if !q.member {
+			continue
+		}
+		plan.Members = append(plan.Members, PlanMember{
+			Name:     q.name,
+			Quotum:   q.quotum,
+			Used:     q.used,
+			Rejected: q.rejected,
+			Exceeded: q.exceeded(),
+		})
+	}
+	return plan, err
+}
@@ -0,0 +1,271 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	shell "github.com/adriamb/go-ipfs-api"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultWorkers is the default number of concurrent IPFS requests
+	DefaultWorkers = 4
+
+	// prefetchFactor bounds the objects fetched in advance to this factor of
+	// the workers
+	prefetchFactor = 4
+
+	// maxPendingPins is the number of pins waiting to be done that stops the
+	// traversal until some are done
+	maxPendingPins = 1024
+)
+
+// poolJob is an IPFS object to fetch or to pin.
+type poolJob struct {
+	hash      string
+	pin       bool
+	recursive bool
+	done      chan struct{}
+
+	object *shell.IpfsObject
+	err    error
+	time   time.Duration
+}
+
+// poolQueues are the jobs waiting to run for each member, taken in turns.
+type poolQueues struct {
+	jobs  map[string][]*poolJob
+	order []string
+}
+
+// pinPool fetches and pins IPFS objects with a bounded number of concurrent
+// requests. Jobs are queued by member, and members are served in turns so a
+// big member cannot starve the others. Fetches go before pins, since the
+// sync waits for them. Once ctx is cancelled, the queued jobs and the new
+// ones are finished with the error of ctx, and only the running ones are
+// waited for.
+type pinPool struct {
+	sync.Mutex
+	cond *sync.Cond
+
+	ctx     context.Context
+	err     error
+	ipfs    IPFSClient
+	workers int
+	running int
+
+	fetches  map[string]*poolJob
+	pending  int
+	finished []*poolJob
+
+	fetchq poolQueues
+	pinq   poolQueues
+}
+
+func newPinPool(ctx context.Context, ipfs IPFSClient, workers int) *pinPool {
+	if workers < 1 {
+		workers = 1
+	}
+	p := &pinPool{
+		ctx:     ctx,
+		ipfs:    ipfs,
+		workers: workers,
+		fetches: make(map[string]*poolJob),
+		fetchq:  poolQueues{jobs: make(map[string][]*poolJob)},
+		pinq:    poolQueues{jobs: make(map[string][]*poolJob)},
+	}
+	p.cond = sync.NewCond(&p.Mutex)
+	if ctx.Done() != nil {
+		go func() {
+			<-ctx.Done()
+			p.cancel()
+		}()
+	}
+	return p
+}
+
+// cancel finishes the queued jobs with the error of the context.
+func (p *pinPool) cancel() {
+	p.Lock()
+	defer p.Unlock()
+
+	p.err = p.ctx.Err()
+	for _, q := range []*poolQueues{&p.fetchq, &p.pinq} {
+		for job := q.pop(); job != nil; job = q.pop() {
+			p.finish(job, p.err)
+		}
+	}
+	p.cond.Broadcast()
+}
+
+// finish closes a job that did not run, must be called with the lock held.
+func (p *pinPool) finish(job *poolJob, err error) {
+	job.err = err
+	close(job.done)
+	if job.pin {
+		p.pending--
+		p.finished = append(p.finished, job)
+	}
+}
+
+func (q *poolQueues) push(member string, job *poolJob) {
+	if _, ok := q.jobs[member]; !ok {
+		q.order = append(q.order, member)
+	}
+	q.jobs[member] = append(q.jobs[member], job)
+}
+
+// pop takes the next job of the first member in turn, and moves the member
+// to the end of the turns if it has more jobs.
+func (q *poolQueues) pop() *poolJob {
+	if len(q.order) == 0 {
+		return nil
+	}
+	member := q.order[0]
+	q.order = q.order[1:]
+
+	job := q.jobs[member][0]
+	q.jobs[member] = q.jobs[member][1:]
+	if len(q.jobs[member]) == 0 {
+		delete(q.jobs, member)
+	} else {
+		q.order = append(q.order, member)
+	}
+	return job
+}
+
+// fetch requests to get an object in background, if not already requested.
+func (p *pinPool) fetch(member, hash string) *poolJob {
+	p.Lock()
+	job, ok := p.fetches[hash]
+	if !ok {
+		job = &poolJob{hash: hash, done: make(chan struct{})}
+		p.fetches[hash] = job
+		if p.err != nil {
+			p.finish(job, p.err)
+		} else {
+			p.fetchq.push(member, job)
+		}
+	}
+	p.Unlock()
+
+	p.schedule()
+	return job
+}
+
+// object gets an object, waiting if it is still being fetched or until the
+// context is cancelled.
+func (p *pinPool) object(member, hash string) (*shell.IpfsObject, error) {
+	job := p.fetch(member, hash)
+	select {
+	case <-job.done:
+	case <-p.ctx.Done():
+		return nil, p.ctx.Err()
+	}
+
+	p.Lock()
+	delete(p.fetches, hash)
+	p.Unlock()
+
+	return job.object, job.err
+}
+
+// pin requests to pin an object in background.
+func (p *pinPool) pin(member, hash string, recursive bool) {
+	p.Lock()
+	job := &poolJob{hash: hash, pin: true, recursive: recursive, done: make(chan struct{})}
+	p.pending++
+	if p.err != nil {
+		p.finish(job, p.err)
+	} else {
+		p.pinq.push(member, job)
+	}
+	p.Unlock()
+
+	p.schedule()
+}
+
+// fetching returns the number of fetches requested and not yet taken.
+func (p *pinPool) fetching() int {
+	p.Lock()
+	defer p.Unlock()
+	return len(p.fetches)
+}
+
+// throttle waits while there are more than max pins not done.
+func (p *pinPool) throttle(max int) {
+	p.Lock()
+	for p.pending > max {
+		p.cond.Wait()
+	}
+	p.Unlock()
+}
+
+// done returns the pins finished since the last call, without waiting.
+func (p *pinPool) done() []*poolJob {
+	p.Lock()
+	defer p.Unlock()
+	pins := p.finished
+	p.finished = nil
+	return pins
+}
+
+// wait waits until all the requested jobs are done, and returns the pins
+// not yet returned.
+func (p *pinPool) wait() []*poolJob {
+	p.Lock()
+	fetches := p.fetches
+	p.fetches = make(map[string]*poolJob)
+	p.Unlock()
+
+	for _, job := range fetches {
+		<-job.done
+	}
+	p.throttle(0)
+	return p.done()
+}
+
+// schedule runs queued jobs while there are free workers.
+func (p *pinPool) schedule() {
+	p.Lock()
+	defer p.Unlock()
+
+	for p.running < p.workers {
+		job := p.fetchq.pop()
+		if job == nil {
+			job = p.pinq.pop()
+		}
+		if job == nil {
+			return
+		}
+		p.running++
+		go p.run(job)
+	}
+}
+
+func (p *pinPool) run(job *poolJob) {
+
+	start := time.Now()
+	if job.pin {
+		log.WithField("hash", job.hash).Debug("Pinning object")
+		job.err = p.ipfs.Pin(job.hash, job.recursive)
+	} else {
+		log.WithField("hash", job.hash).Debug("Fetching object")
+		job.object, job.err = p.ipfs.ObjectGet(job.hash)
+	}
+	job.time = time.Since(start)
+	close(job.done)
+
+	p.Lock()
+	p.running--
+	if job.pin {
+		p.pending--
+		p.finished = append(p.finished, job)
+		p.cond.Broadcast()
+	}
+	p.Unlock()
+
+	p.schedule()
+}
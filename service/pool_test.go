@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+
+	shell "github.com/adriamb/go-ipfs-api"
+	"github.com/stretchr/testify/assert"
+)
+
+// orderIPFSMock records the order of the pins, the first one waits for gate.
+type orderIPFSMock struct {
+	sync.Mutex
+	gate  chan struct{}
+	order []string
+}
+
+func (m *orderIPFSMock) Cat(path string) (io.ReadCloser, error) {
+	return nil, errors.New("Not implemented")
+}
+
+func (m *orderIPFSMock) Add(r io.Reader) (string, error) {
+	return "", errors.New("Not implemented")
+}
+
+func (m *orderIPFSMock) ObjectGet(path string) (*shell.IpfsObject, error) {
+	return &shell.IpfsObject{Data: path}, nil
+}
+
+func (m *orderIPFSMock) Pin(path string, recursive bool) error {
+	m.Lock()
+	first := len(m.order) == 0
+	m.order = append(m.order, path)
+	m.Unlock()
+	if first {
+		<-m.gate
+	}
+	return nil
+}
+
+func (m *orderIPFSMock) Unpin(path string) error {
+	return nil
+}
+
+func TestPinPoolFairness(t *testing.T) {
+	ipfs := &orderIPFSMock{gate: make(chan struct{})}
+	pool := newPinPool(context.Background(), ipfs, 1)
+
+	pool.pin("big.eth", "a1", false)
+	pool.pin("big.eth", "a2", false)
+	pool.pin("big.eth", "a3", false)
+	pool.pin("big.eth", "a4", false)
+	pool.pin("small.eth", "b1", false)
+	pool.pin("small.eth", "b2", false)
+	close(ipfs.gate)
+
+	pins := pool.wait()
+	assert.Equal(t, 6, len(pins))
+	assert.Equal(t, []string{"a1", "a2", "b1", "a3", "b2", "a4"}, ipfs.order)
+}
+
+func TestPinPoolFetch(t *testing.T) {
+	ipfs := &orderIPFSMock{gate: make(chan struct{})}
+	pool := newPinPool(context.Background(), ipfs, 2)
+
+	pool.fetch("a.eth", "h1")
+	object, err := pool.object("a.eth", "h1")
+	assert.Nil(t, err)
+	assert.Equal(t, "h1", object.Data)
+
+	object, err = pool.object("a.eth", "h2")
+	assert.Nil(t, err)
+	assert.Equal(t, "h2", object.Data)
+	assert.Equal(t, 0, len(pool.wait()))
+}
@@ -0,0 +1,201 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var quotumUnits = map[string]uint64{
+	"":    1,
+	"b":   1,
+	"kb":  1000,
+	"mb":  1000 * 1000,
+	"gb":  1000 * 1000 * 1000,
+	"tb":  1000 * 1000 * 1000 * 1000,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+}
+
+// ParseQuotum parses a quotum like "10GB", "500MiB" or "1024" into bytes.
+// An empty quotum means no limit and is returned as 0.
+func ParseQuotum(quotum string) (uint64, error) {
+
+	quotum = strings.TrimSpace(quotum)
+	if quotum == "" {
+		return 0, nil
+	}
+
+	split := strings.IndexFunc(quotum, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if split == -1 {
+		split = len(quotum)
+	}
+
+	number, err := strconv.ParseFloat(quotum[:split], 64)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid quotum '%v'", quotum)
+	}
+	unit, ok := quotumUnits[strings.ToLower(strings.TrimSpace(quotum[split:]))]
+	if !ok {
+		return 0, fmt.Errorf("Invalid quotum unit in '%v'", quotum)
+	}
+
+	return uint64(number * float64(unit)), nil
+}
+
+// QuotaViolation reports a quotum that was exceeded during a sync.
+type QuotaViolation struct {
+	Name   string `json:"name"`
+	Quotum string `json:"quotum"`
+	Used   uint64 `json:"used"`
+	Over   uint64 `json:"over"`
+}
+
+// quota tracks the bytes charged against a quotum during a sync. Quotas are
+// chained from a pinning manifest up to the consortiums that include it, and
+// a hash is only accepted if it fits in every quota of the chain. The quota
+// also counts the pinned hashes kept in the chain, if some hash of its own
+// failed, and if its usage is incomplete because of an error in the chain.
+type quota struct {
+	index      int
+	name       string
+	quotum     string
+	member     bool
+	limit      uint64
+	used       uint64
+	rejected   uint64
+	kept       int
+	failed     bool
+	incomplete bool
+	parent     *quota
+	charged    map[string]uint64
+	refused    map[string]bool
+}
+
+func newQuota(name, quotum string, parent *quota) (*quota, error) {
+	limit, err := ParseQuotum(quotum)
+	if err != nil {
+		return nil, err
+	}
+	return &quota{
+		name:    name,
+		quotum:  quotum,
+		limit:   limit,
+		parent:  parent,
+		charged: make(map[string]uint64),
+		refused: make(map[string]bool),
+	}, nil
+}
+
+// owner returns the name of the consortium member that the quota belongs to,
+// or an empty string.
+func (q *quota) owner() string {
+	for n := q; n != nil; n = n.parent {
+		if n.member {
+			return n.name
+		}
+	}
+	return ""
+}
+
+// seen returns if the hash has been already charged to this quota.
+func (q *quota) seen(hash string) bool {
+	if q == nil {
+		return false
+	}
+	_, ok := q.charged[hash]
+	return ok
+}
+
+// charge accounts size bytes for hash in the whole chain of quotas. Returns
+// false, without charging anything, if some quota of the chain is exceeded.
+func (q *quota) charge(hash string, size uint64) bool {
+
+	for n := q; n != nil; n = n.parent {
+		if n.seen(hash) || n.limit == 0 || n.used+size <= n.limit {
+			continue
+		}
+		if !n.refused[hash] {
+			n.refused[hash] = true
+			n.rejected += size
+		}
+		log.WithFields(log.Fields{
+			"name":   n.name,
+			"quotum": n.quotum,
+			"hash":   hash,
+		}).Warn("Quota exceeded, refusing to pin")
+		return false
+	}
+
+	for n := q; n != nil; n = n.parent {
+		if !n.seen(hash) {
+			n.charged[hash] = size
+			n.used += size
+		}
+	}
+	return true
+}
+
+// include charges hashes without size in the whole chain of quotas, since
+// their size was charged with the object that links them.
+func (q *quota) include(hashes []string) {
+	for n := q; n != nil; n = n.parent {
+		for _, hash := range hashes {
+			if !n.seen(hash) {
+				n.charged[hash] = 0
+			}
+		}
+	}
+}
+
+// keep counts a pinned hash kept by the sync in the whole chain of quotas.
+func (q *quota) keep() {
+	for n := q; n != nil; n = n.parent {
+		n.kept++
+	}
+}
+
+// fail records that a hash charged to the quota could not be fetched or
+// pinned.
+func (q *quota) fail() {
+	if q != nil {
+		q.failed = true
+	}
+}
+
+// miss records in the whole chain of quotas that some hash or source charged
+// to them had an error, so their usage is incomplete.
+func (q *quota) miss() {
+	for n := q; n != nil; n = n.parent {
+		n.incomplete = true
+	}
+}
+
+// exceeded returns if some quota of the chain refused a hash.
+func (q *quota) exceeded() bool {
+	for n := q; n != nil; n = n.parent {
+		if len(n.refused) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// violation returns the quota violation, if any.
+func (q *quota) violation() *QuotaViolation {
+	if q.rejected == 0 {
+		return nil
+	}
+	return &QuotaViolation{
+		Name:   q.name,
+		Quotum: q.quotum,
+		Used:   q.used,
+		Over:   q.used + q.rejected - q.limit,
+	}
+}
@@ -0,0 +1,35 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseQuotum(t *testing.T) {
+	q, err := ParseQuotum("")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), q)
+
+	q, err = ParseQuotum("1024")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1024), q)
+
+	q, err = ParseQuotum("10GB")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(10000000000), q)
+
+	q, err = ParseQuotum("500 MiB")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(500*1024*1024), q)
+
+	q, err = ParseQuotum("1.5kb")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1500), q)
+
+	_, err = ParseQuotum("10XB")
+	assert.NotNil(t, err)
+
+	_, err = ParseQuotum("GB")
+	assert.NotNil(t, err)
+}
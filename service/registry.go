@@ -0,0 +1,87 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+
+	eth "github.com/ipfsconsortium/go-ipfsc/eth"
+	log "github.com/sirupsen/logrus"
+)
+
+/*
+Pin registries are contracts that hold a list of entries to be pinned, each
+entry is an expression like the ones in a pinning manifest (an /ipfs/ hash, an
+ENS name or another registry). Registries must implement:
+
+	contract PinRegistry {
+	    function pinCount() public view returns (uint256);
+	    function pinAt(uint256 index) public view returns (string);
+	}
+*/
+const pinRegistryAbi string = `
+[{"constant":true,"inputs":[],"name":"pinCount","outputs":[{"name":"","type":"uint256"}],"payable":false,"stateMutability":"view","type":"function"},{"constant":true,"inputs":[{"name":"index","type":"uint256"}],"name":"pinAt","outputs":[{"name":"","type":"string"}],"payable":false,"stateMutability":"view","type":"function"}]
+`
+
+const (
+	// MaxRegistryPins is the maximum number of entries read from a registry
+	MaxRegistryPins = 10000
+)
+
+type RegistryClient interface {
+	Pins(ctx context.Context, address common.Address) ([]string, error)
+}
+
+type RegistryClientImpl struct {
+	client   *eth.Web3Client
+	registry abi.ABI
+}
+
+func NewRegistryClient(client *eth.Web3Client) (RegistryClient, error) {
+
+	registryabi, err := abi.JSON(bytes.NewReader([]byte(pinRegistryAbi)))
+	if err != nil {
+		return nil, err
+	}
+
+	return &RegistryClientImpl{client, registryabi}, nil
+}
+
+func (r *RegistryClientImpl) Pins(ctx context.Context, address common.Address) ([]string, error) {
+
+	registry, err := eth.NewContract(r.client, &r.registry, nil, &address)
+	if err != nil {
+		return nil, err
+	}
+
+	// all the entries are read from the same block, so they are consistent
+	// if the registry is updated while reading them
+	header, err := r.client.Client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	block := header.Number
+
+	var count *big.Int
+	if err := registry.CallContextAt(ctx, block, &count, "pinCount"); err != nil {
+		return nil, err
+	}
+	if count.Cmp(big.NewInt(MaxRegistryPins)) > 0 {
+		return nil, fmt.Errorf("Registry %v has too many entries (%v)", address.Hex(), count)
+	}
+
+	log.Debug("Registry ", address.Hex(), " has ", count, " entries at block ", block)
+
+	pins := make([]string, count.Int64())
+	for i := range pins {
+		if err := registry.CallContextAt(ctx, block, &pins[i], "pinAt", big.NewInt(int64(i))); err != nil {
+			return nil, err
+		}
+	}
+
+	return pins, nil
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	sto "github.com/ipfsconsortium/go-ipfsc/storage"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultRetryDelay is the default delay to retry a failed hash, that is
+	// doubled on each consecutive failure
+	DefaultRetryDelay = time.Minute
+
+	// DefaultMaxRetryDelay is the default maximum delay to retry a hash
+	DefaultMaxRetryDelay = 24 * time.Hour
+
+	// DefaultMaxRetries is the default number of consecutive failures after
+	// which a hash fails permanently
+	DefaultMaxRetries = 10
+)
+
+// FailedHash reports an IPFS hash that failed permanently.
+type FailedHash struct {
+	Hash      string    `json:"hash"`
+	Failures  uint      `json:"failures"`
+	Error     string    `json:"error"`
+	NextRetry time.Time `json:"nextretry"`
+}
+
+// deferred returns if an IPFS hash failed before and it is not time yet to
+// retry it, then it is reported as failed and its last links are kept
+// counting them in q.
+func (s *Service) deferred(hash string, q *quota) bool {
+
+	fentry, err := s.storage.Failure(hash)
+	if err != nil {
+		log.WithError(err).Warn("Failed to read failures of " + hash)
+		return false
+	}
+	if fentry == nil {
+		return false
+	}
+	s.retrying[hash] = true
+
+	if fentry.Epoch != s.epoch {
+		fentry.Epoch = s.epoch
+		if err := s.storage.SetFailure(hash, fentry); err != nil {
+			log.WithError(err).Warn("Failed to update failures of " + hash)
+		}
+	}
+
+	next := time.Unix(int64(fentry.NextRetry), 0)
+	if !time.Now().Before(next) {
+		return false
+	}
+
+	s.failures++
+	if fentry.Permanent {
+		s.permanent(hash, fentry)
+		return true
+	}
+	s.stat(func(stats *ServiceStats) {
+		stats.Deferred++
+	})
+	log.WithFields(log.Fields{
+		"hash":     hash,
+		"failures": fentry.Failures,
+		"next":     next,
+	}).Info("Retry deferred")
+	s.skip(hash, fmt.Errorf("retry deferred until %v: %v", next.UTC().Format(time.RFC3339), fentry.LastError), q)
+	return true
+}
+
+// retry records that an IPFS hash could not be fetched or pinned, and when to
+// retry it. The delay doubles with each consecutive failure, and after
+// MaxRetries failures the hash fails permanently: it is retried only every
+// MaxRetryDelay, and its failures are not counted as errors. Meanwhile its
+// last links are kept counting them in q.
+func (s *Service) retry(hash string, err error, q *quota) {
+
+	s.failures++
+	fentry, ferr := s.storage.Failure(hash)
+	if ferr != nil || fentry == nil {
+		fentry = &sto.FailureEntry{}
+	}
+	fentry.Failures++
+	fentry.LastError = err.Error()
+	fentry.Epoch = s.epoch
+
+	delay := s.RetryDelay
+	for i := uint(1); i < fentry.Failures && delay < s.MaxRetryDelay; i++ {
+		delay *= 2
+	}
+	if s.MaxRetries > 0 && fentry.Failures >= s.MaxRetries {
+		fentry.Permanent = true
+		delay = s.MaxRetryDelay
+	}
+	if delay > s.MaxRetryDelay {
+		delay = s.MaxRetryDelay
+	}
+	fentry.NextRetry = uint64(time.Now().Add(delay).Unix())
+
+	if err := s.storage.SetFailure(hash, fentry); err != nil {
+		log.WithError(err).Warn("Failed to store failures of " + hash)
+	}
+	s.retrying[hash] = true
+
+	if fentry.Permanent {
+		s.permanent(hash, fentry)
+		return
+	}
+	s.skip(hash, err, q)
+}
+
+// permanent reports an IPFS hash that failed permanently.
+func (s *Service) permanent(hash string, fentry *sto.FailureEntry) {
+	log.WithFields(log.Fields{
+		"hash":     hash,
+		"failures": fentry.Failures,
+		"error":    fentry.LastError,
+	}).Warn("Hash failed permanently")
+	s.stat(func(stats *ServiceStats) {
+		stats.PermanentFailures = append(stats.PermanentFailures, FailedHash{
+			Hash:      hash,
+			Failures:  fentry.Failures,
+			Error:     fentry.LastError,
+			NextRetry: time.Unix(int64(fentry.NextRetry), 0),
+		})
+	})
+}
+
+// recovered removes the failures of an IPFS hash once pinned.
+func (s *Service) recovered(hash string) {
+	if !s.retrying[hash] {
+		return
+	}
+	delete(s.retrying, hash)
+	if err := s.storage.DeleteFailure(hash); err != nil {
+		log.WithError(err).Warn("Failed to remove failures of " + hash)
+	}
+}
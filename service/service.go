@@ -1,20 +1,163 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common"
+	eth "github.com/ipfsconsortium/go-ipfsc/eth"
 	sto "github.com/ipfsconsortium/go-ipfsc/storage"
 	log "github.com/sirupsen/logrus"
 )
 
+const (
+	// DefaultMaxDepth is the default maximum nesting of ENS names
+	DefaultMaxDepth = 16
+
+	// PinDirect and PinRecursive are the pin modes
+	PinDirect    = "direct"
+	PinRecursive = "recursive"
+
+	// firstEpoch is the first sync epoch, lower ones are the marks of
+	//   hashes stored by previous versions
+	firstEpoch = 2
+)
+
 type Service struct {
-	ipfsc     *Ipfsc
-	storage   *sto.Storage
+	// MaxDepth is the maximum nesting of ENS names while collecting
+	MaxDepth int
+
+	// PinMode is PinDirect to pin each object of a DAG, or PinRecursive to
+	//   pin recursively the IPFS hashes of the manifests
+	PinMode string
+
+	// Workers is the maximum number of concurrent IPFS requests
+	Workers int
+
+	// RetryDelay is the delay to retry a hash that failed, doubled on each
+	//   consecutive failure up to MaxRetryDelay. After MaxRetries failures
+	//   the hash fails permanently
+	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration
+	MaxRetries    uint
+
+	// GraceSyncs and GracePeriod are the consecutive syncs or the time that
+	//   a hash must not be marked before it is unpinned, whatever is reached
+	//   first. Zero values are not used, and if both are zero unmarked hashes
+	//   are unpinned at once
+	GraceSyncs  uint
+	GracePeriod time.Duration
+
+	ipfsc   *Ipfsc
+	storage *sto.Storage
+
+	// context of the current sync, cancelled when the sync ends
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// stats of the current and last syncs, and the event scanner whose
+	//   status is served with them, guarded by mutex
+	mutex     sync.Mutex
 	stats     ServiceStats
 	laststats ServiceStats
+	scanner   *eth.ScanEventDispatcher
+
+	quotas []*quota
+
+	// per-sync memoization of ENS texts, manifests and registries, and the
+	//   stack of ENS names and registries being collected
+	texts      map[string]textResult
+	manifests  map[string]manifestResult
+	registries map[string]textResults
+	visiting   []string
+
+	// ENS entries reached from each root, and the root being collected
+	names map[string]map[string]bool
+	root  string
+
+	// ENS names whose manifests are read again, the others are taken from
+	//   the cache, nil to read all of them
+	changed map[string]bool
+
+	// stack of sources being collected, the IPFS hashes reached from each
+	//   source, the sources that failed to resolve, the errors that do not
+	//   prevent collecting garbage and the stale sources to report with the
+	//   hashes they kept once traversed
+	sources []string
+	reached map[string]map[string]bool
+	failed  map[string]bool
+	scoped  int
+	stales  []staleSource
+
+	// epoch of the current sync, and the hashes reached from unchanged
+	//   pinning manifests that are carried over without marking them
+	epoch   uint64
+	carried map[string]bool
+
+	// number and size of the pinned hashes, counted once and updated since
+	//   if counted, and the hashes kept pinned by the current sync. If all
+	//   the pinned hashes are kept there is no garbage to collect
+	counted     bool
+	pinnedCount int
+	pinnedSize  uint
+	kept        map[string]bool
+
+	// members with objects in their traversal queues, in turns to visit them
+	frontiers []string
+
+	// pool of IPFS requests, the hashes being pinned and failed to pin, and
+	//   the pinning manifests to store when pinned
+	pool     *pinPool
+	pinning  map[string]*sto.HashEntry
+	unpinned map[string]bool
+	leaves   []pendingLeaf
+
+	// objects pinned recursively to pin directly when their links are pinned
+	demoting []string
+
+	// hashes with failures stored, and the count of fetches and pins that
+	//   failed or were deferred
+	retrying map[string]bool
+	failures int
+
+	// path of the IPFS object being collected
+	path string
+
+	// what the sync would do, and the hashes in it, only when planning
+	plan     *SyncPlan
+	recorded map[string]bool
+}
+
+// staleSource is a source whose cached copy was collected, with its index in
+// the degraded sources and the quota of its hashes.
+type staleSource struct {
+	index int
+	q     *quota
+}
+
+type textResult struct {
+	text string
+	err  error
+}
+
+type textResults struct {
+	texts []string
+	err   error
+}
+
+// manifestResult is a manifest read from an ENS name, with its IPFS hash. If
+// the manifest cannot be read, stale has the error and the manifest is the
+// cached copy.
+type manifestResult struct {
+	manifest interface{}
+	hash     string
+	stale    error
+	err      error
 }
 
 var (
@@ -24,217 +167,1589 @@ var (
 )
 
 func NewService(ipfsc *Ipfsc, storage *sto.Storage) *Service {
-	return &Service{ipfsc: ipfsc, storage: storage}
+	return &Service{
+		MaxDepth:      DefaultMaxDepth,
+		PinMode:       PinDirect,
+		Workers:       DefaultWorkers,
+		RetryDelay:    DefaultRetryDelay,
+		MaxRetryDelay: DefaultMaxRetryDelay,
+		MaxRetries:    DefaultMaxRetries,
+		ipfsc:         ipfsc,
+		storage:       storage,
+		names:         make(map[string]map[string]bool),
+	}
+}
+
+// SetIpfsc replaces the IPFS and ENS clients, e.g. when their endpoints
+// change. It must not be called while syncing.
+func (s *Service) SetIpfsc(ipfsc *Ipfsc) {
+	s.ipfsc = ipfsc
+}
+
+// readText reads an ENS text, memoized for the current sync.
+func (s *Service) readText(ensname, key string) (string, error) {
+	memokey := key + "[" + ensname + "]"
+	if r, ok := s.texts[memokey]; ok {
+		return r.text, r.err
+	}
+	text, err := s.ipfsc.ENS().Text(s.ctx, ensname, key)
+	s.texts[memokey] = textResult{text, err}
+	return text, err
+}
+
+// readManifest reads the manifest of an ENS name, memoized for the current sync.
+func (s *Service) readManifest(ensname string) manifestResult {
+	if r, ok := s.manifests[ensname]; ok {
+		log.WithField("ensname", ensname).Debug("Manifest already read")
+		return r
+	}
+	r := s.fetchManifest(ensname)
+	s.manifests[ensname] = r
+	return r
+}
+
+// fetchManifest reads the manifest of an ENS name, and caches it in the db.
+// The cached copy is used if the manifest did not change, or if the ENS name
+// or the manifest cannot be read.
+func (s *Service) fetchManifest(ensname string) manifestResult {
+
+	cached, err := s.storage.Manifest(ensname)
+	if err != nil {
+		log.WithError(err).Warn("Failed to read cached manifest of " + ensname)
+		cached = nil
+	}
+	if cached != nil && s.changed != nil && !s.changed[ensname] {
+		if manifest, err := parse(cached.Data); err == nil {
+			return manifestResult{manifest: manifest, hash: cached.Hash}
+		}
+	}
+
+	fallback := func(err error) manifestResult {
+		if cached == nil {
+			return manifestResult{err: err}
+		}
+		manifest, perr := parse(cached.Data)
+		if perr != nil {
+			return manifestResult{err: err}
+		}
+		log.WithFields(log.Fields{
+			"ensname": ensname,
+			"hash":    cached.Hash,
+			"block":   cached.Block,
+		}).Warn("Using cached manifest")
+		return manifestResult{manifest: manifest, hash: cached.Hash, stale: err}
+	}
+
+	ipfshash, err := s.readText(ensname, DefaultManifestKey)
+	if err != nil {
+		return fallback(err)
+	}
+
+	changed := cached == nil || cached.Hash != ipfshash
+	if !changed {
+		if manifest, err := parse(cached.Data); err == nil {
+			return manifestResult{manifest: manifest, hash: ipfshash}
+		}
+	}
+
+	data, err := s.ipfsc.Fetch(s.ctx, ipfshash)
+	if err != nil {
+		return fallback(err)
+	}
+	manifest, err := parse(data)
+	if err != nil {
+		return fallback(err)
+	}
+
+	log.WithFields(log.Fields{
+		"ensname": ensname,
+		"hash":    ipfshash,
+		"changed": changed,
+	}).Info("Manifest read")
+
+	entry := &sto.ManifestEntry{
+		Hash: ipfshash,
+		Data: data,
+		Seen: uint64(time.Now().Unix()),
+	}
+	if entry.Block, err = s.ipfsc.ENS().BlockNumber(s.ctx); err != nil {
+		log.WithError(err).Warn("Failed to get block number")
+	}
+	if err = s.storage.SetManifest(ensname, entry); err != nil {
+		log.WithError(err).Warn("Failed to cache manifest of " + ensname)
+	}
+
+	return manifestResult{manifest: manifest, hash: ipfshash}
+}
+
+// readRegistry reads the entries of a pin registry, memoized for the current sync.
+func (s *Service) readRegistry(address common.Address) ([]string, error) {
+	if r, ok := s.registries[address.Hex()]; ok {
+		return r.texts, r.err
+	}
+	pins, err := s.ipfsc.Registry().Pins(s.ctx, address)
+	s.registries[address.Hex()] = textResults{pins, err}
+	return pins, err
+}
+
+// enter pushes name in the stack of names being collected, returns false
+// if there is a cycle or the maximum nesting is reached.
+func (s *Service) enter(name, path string) bool {
+	for _, visiting := range s.visiting {
+		if visiting == name {
+			cycle := strings.Join(append(s.visiting, name), ">")
+			log.WithField("path", path).Warn("Cycle detected " + cycle)
+			s.stat(func(stats *ServiceStats) {
+				stats.Cycles = append(stats.Cycles, cycle)
+			})
+			return false
+		}
+	}
+	if len(s.visiting) >= s.MaxDepth {
+		log.Warn("Maximum nesting reached " + path + ">" + name)
+		s.fail()
+		return false
+	}
+	s.visiting = append(s.visiting, name)
+	return true
+}
+
+// leave pops the last name in the stack of names being collected.
+func (s *Service) leave() {
+	s.visiting = s.visiting[:len(s.visiting)-1]
+}
+
+// track records that the ENS text key of ensname is reached from the
+// current root.
+func (s *Service) track(key, ensname string) {
+	entry := key + "[" + ensname + "]"
+	roots, ok := s.names[entry]
+	if !ok {
+		roots = make(map[string]bool)
+		s.names[entry] = roots
+	}
+	roots[s.root] = true
+}
+
+// untrack removes all ENS entries reached from root.
+func (s *Service) untrack(root string) {
+	for entry, roots := range s.names {
+		delete(roots, root)
+		if len(roots) == 0 {
+			delete(s.names, entry)
+		}
+	}
+}
+
+// Names returns the ENS entries, like "consortiumManifest[name.eth]", reached
+// in the last syncs, with the roots they are reached from.
+func (s *Service) Names() map[string][]string {
+	names := make(map[string][]string)
+	for entry, roots := range s.names {
+		for root := range roots {
+			names[entry] = append(names[entry], root)
+		}
+	}
+	return names
+}
+
+// stat updates the stats of the current sync, they are only updated from the
+// sync but also read from the http server.
+func (s *Service) stat(update func(stats *ServiceStats)) {
+	s.mutex.Lock()
+	update(&s.stats)
+	s.mutex.Unlock()
+}
+
+// fail counts an error in the current sync.
+func (s *Service) fail() {
+	s.stat(func(stats *ServiceStats) {
+		stats.Errors++
+	})
+}
+
+// degraded adds a degraded source to the stats of the current sync.
+func (s *Service) degraded(degraded DegradedSource) {
+	s.stat(func(stats *ServiceStats) {
+		stats.Degraded = append(stats.Degraded, degraded)
+	})
+}
+
+// Stats returns a copy of the stats of the current and the last sync.
+func (s *Service) Stats() (current, last ServiceStats) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.stats.clone(), s.laststats.clone()
+}
+
+// SetScanner sets the event scanner that detects the changed ENS entries,
+// nil if there is none.
+func (s *Service) SetScanner(scanner *eth.ScanEventDispatcher) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.scanner = scanner
+}
+
+// ScannerStatus returns the status of the event scanner, or nil if there is
+// none.
+func (s *Service) ScannerStatus() *eth.ScanStatus {
+	s.mutex.Lock()
+	scanner := s.scanner
+	s.mutex.Unlock()
+	if scanner == nil {
+		return nil
+	}
+	status := scanner.Status()
+	return &status
+}
+
+// push starts collecting a source.
+func (s *Service) push(source string) {
+	s.sources = append(s.sources, source)
+	if _, ok := s.reached[source]; !ok {
+		s.reached[source] = make(map[string]bool)
+	}
+}
+
+// pop ends collecting the last source.
+func (s *Service) pop() {
+	s.sources = s.sources[:len(s.sources)-1]
+}
+
+// reach records that the IPFS hash is reached from the sources being collected.
+func (s *Service) reach(hash string) {
+	for _, source := range s.sources {
+		s.reached[source][hash] = true
+	}
+}
+
+// degrade records that a source failed to resolve, and keeps marked the
+// hashes reached from it the last time it was resolved, counting them in q.
+// If it was never resolved, it is not safe to collect garbage.
+func (s *Service) degrade(source string, err error, q *quota) {
+
+	if s.cancelled() {
+		// the source was not resolved because the sync is stopping
+		return
+	}
+	s.fail()
+	again := s.failed[source]
+	s.failed[source] = true
+
+	degraded := DegradedSource{Source: source, Error: err.Error()}
+	rentry, rerr := s.storage.Resolves(source)
+	if rerr != nil || rentry == nil {
+		log.WithField("source", source).Warn("Source never resolved, garbage collection disabled")
+		degraded.Blocking = true
+	} else {
+		s.scoped++
+		for _, hash := range rentry.Entries {
+			s.reach(hash)
+			degraded.Protected += s.protect(hash, source, q)
+			if err := s.storage.TouchWhy(hash, s.epoch); err != nil {
+				log.WithError(err).Warn("Failed to update why index")
+			}
+		}
+		log.WithFields(log.Fields{
+			"source":    source,
+			"protected": degraded.Protected,
+		}).Warn("Source degraded, keeping its last resolution")
+	}
+
+	if !again {
+		s.degraded(degraded)
+	}
+}
+
+// stale records that a source failed to resolve, and that its cached copy
+// was collected instead with quota q. The pinned hashes that it keeps are
+// counted once traversed, by reportStales.
+func (s *Service) stale(source string, err error, q *quota) {
+
+	s.fail()
+	s.scoped++
+	if !s.failed[source] {
+		s.stat(func(stats *ServiceStats) {
+			s.stales = append(s.stales, staleSource{len(stats.Degraded), q})
+			stats.Degraded = append(stats.Degraded, DegradedSource{
+				Source: source,
+				Error:  err.Error(),
+			})
+		})
+	}
+	s.failed[source] = true
+}
+
+// reportStales sets the pinned hashes kept by the stale sources, when their
+// hashes have been traversed.
+func (s *Service) reportStales() {
+	s.stat(func(stats *ServiceStats) {
+		for _, stale := range s.stales {
+			if stale.q != nil {
+				stats.Degraded[stale.index].Protected = stale.q.kept
+			}
+		}
+	})
+	s.stales = nil
+}
+
+// protect marks a cached hash and its links reached from a source, counting
+// them in q, returns the number of hashes that were not already marked.
+func (s *Service) protect(hash, source string, q *quota) int {
+
+	protected := 0
+	for stack := []string{hash}; len(stack) > 0; {
+		hash, stack = stack[len(stack)-1], stack[:len(stack)-1]
+
+		hentry, err := s.storage.Hash(hash)
+		if err != nil || hentry == nil || hentry.Dirty || hentry.Epoch == s.epoch || s.carried[hash] {
+			continue
+		}
+		hentry.Epoch = s.epoch
+		hentry.MissedSince = 0
+		hentry.MissedSyncs = 0
+		if err := s.storage.UpdateHash(hash, hentry); err != nil {
+			log.WithError(err).Warn("Failed to update hash db")
+			s.fail()
+			continue
+		}
+		s.kept[hash] = true
+		q.keep()
+		protected++
+		s.record(PlanKeep, hash, source, "", uint64(hentry.DataSize))
+
+		stack = append(stack, hentry.Links...)
+	}
+	return protected
+}
+
+// skip records that an IPFS hash could not be fetched or pinned. If it was
+// fetched its links are collected, else like a degraded source the hashes it
+// linked when it was last pinned are kept marked, counting them in q. If its
+// links are unknown, it is not safe to collect garbage.
+func (s *Service) skip(hash string, err error, q *quota) {
+
+	s.fail()
+	degraded := DegradedSource{Source: hash, Error: err.Error()}
+
+	if _, fetched := s.pinning[hash]; fetched {
+		s.scoped++
+	} else if hentry, herr := s.storage.Hash(hash); herr == nil && hentry != nil {
+		s.scoped++
+		roots := hentry.Links
+		if !hentry.Dirty {
+			roots = []string{hash}
+		}
+		for _, root := range roots {
+			degraded.Protected += s.protect(root, hash, q)
+		}
+	} else {
+		log.WithField("hash", hash).Warn("Hash never pinned, garbage collection disabled")
+		degraded.Blocking = true
+	}
+
+	s.degraded(degraded)
+}
+
+// saveResolves stores the hashes reached from the sources resolved in the
+// current sync, only if garbage can be safely collected.
+func (s *Service) saveResolves() {
+
+	if s.stats.Errors != s.scoped {
+		return
+	}
+	for source, hashes := range s.reached {
+		if s.failed[source] {
+			continue
+		}
+		entries := make([]string, 0, len(hashes))
+		for hash := range hashes {
+			entries = append(entries, hash)
+		}
+		sort.Strings(entries)
+		if err := s.storage.SetResolves(source, &sto.ResolvesEntry{Entries: entries}); err != nil {
+			log.WithError(err).Warn("Failed to store resolves of " + source)
+			s.fail()
+		}
+	}
+}
+
+// newQuota creates a quota for the current sync, parsing errors are counted
+// and the quota is created without limit.
+func (s *Service) newQuota(name, quotum string, parent *quota) *quota {
+	q, err := newQuota(name, quotum, parent)
+	if err != nil {
+		log.WithError(err).Warn("Invalid quotum for " + name)
+		s.fail()
+		q, _ = newQuota(name, "", parent)
+	}
+	s.quotas = append(s.quotas, q)
+	q.index = len(s.quotas)
+	return q
 }
 
-func (s *Service) collectENS(expr, path string) {
+func (s *Service) collectENS(expr, path string, q *quota) {
 
 	log.Info("Collecting[ens] " + path + ">" + expr)
 
 	enskey, textkey, err := parseENSEntry(expr)
 	if err != nil {
 		log.WithError(err).Warn("Error parsing ens " + expr)
-		s.stats.Errors++
+		s.fail()
 		return
 	}
 
+	if textkey == "" {
+		s.track(DefaultManifestKey, enskey)
+	} else {
+		s.track(textkey, enskey)
+	}
+
 	// Parse an ENS entry
 	if textkey != "" && textkey != DefaultManifestKey {
 		// an IPFS hash stored in ENS
-		expr, err := s.ipfsc.ENS().Text(enskey, textkey)
+		source := textkey + "[" + enskey + "]"
+		s.push(source)
+		defer s.pop()
+
+		text, err := s.readText(enskey, textkey)
 		if err != nil {
 			log.WithError(err).Warn("Failed to get " + expr)
-			s.stats.Errors++
+			s.degrade(source, err, q)
 			return
 		}
-		s.collect(expr, enskey+">"+path)
+		s.collect(text, enskey+">"+path, q)
+		return
+	}
+
+	// Check for cycles and maximum nesting
+	if !s.enter(enskey, path) {
+		return
 	}
+	defer s.leave()
+
+	source := DefaultManifestKey + "[" + enskey + "]"
+	s.push(source)
+	defer s.pop()
 
 	// Parse manifest entry
-	manifest, err := s.ipfsc.Read(expr)
-	if err != nil {
-		log.WithError(err).Warn("Failed to get " + expr)
-		s.stats.Errors++
+	r := s.readManifest(enskey)
+	if r.err != nil {
+		log.WithError(r.err).Warn("Failed to get " + expr)
+		s.degrade(source, r.err, q)
 		return
 	}
+	var mq *quota
+	if r.stale != nil {
+		log.WithError(r.stale).Warn("Failed to get " + expr)
+		defer func() {
+			s.stale(source, r.stale, mq)
+		}()
+	}
 
-	switch v := manifest.(type) {
+	switch v := r.manifest.(type) {
 
 	case *ConsortiumManifest:
+		consortium := s.newQuota(expr, v.Quotum, q)
+		mq = consortium
 		for _, member := range v.Members {
-			s.collect(member.EnsName, path+">"+member.EnsName)
+			mq := s.newQuota(member.EnsName, member.Quotum, consortium)
+			mq.member = true
+			errs := s.stats.Errors
+			s.collect(member.EnsName, path+">"+member.EnsName, mq)
+			if s.stats.Errors != errs {
+				mq.miss()
+			}
 		}
 		return
 
 	case *PinningManifest:
+		pq := s.newQuota(expr, v.Quotum, q)
+		mq = pq
+		if isLeaf(v) && s.carry(enskey, r.hash, path+"/"+expr, v, pq) {
+			return
+		}
+		member := pq.owner()
+		for _, entry := range v.Pin {
+			if strings.HasPrefix(entry, "/ipfs/") {
+				s.prefetch(member, entry)
+			}
+		}
+		errs, failures := s.stats.Errors, s.failures
 		for i, entry := range v.Pin {
-			s.collect(entry, fmt.Sprintf("%v/%v(#%v)", path, expr, i))
+			s.collect(entry, fmt.Sprintf("%v/%v(#%v)", path, expr, i), pq)
+		}
+		if isLeaf(v) && r.stale == nil && s.stats.Errors == errs && s.failures == failures {
+			s.leaves = append(s.leaves, pendingLeaf{enskey, r.hash, pq})
 		}
 
 	default:
 		log.Warn("Unable to parse manifest " + expr)
-		s.stats.Errors++
+		s.degrade(source, errors.New("unable to parse manifest"), q)
 	}
 
 }
 
-func parseENSEntry(expr string) (enskey, textkey string, err error) {
-	if strings.Contains(expr, "[") {
-		sp1 := strings.Split(expr, "[")
-		if len(sp1) != 2 {
-			return "", "", errors.New("Ill formed ENS name")
+// isLeaf returns if the pinning manifest has only IPFS hashes.
+func isLeaf(manifest *PinningManifest) bool {
+	for _, entry := range manifest.Pin {
+		if !strings.HasPrefix(entry, "/ipfs/") {
+			return false
 		}
-		sp2 := strings.Split(sp1[1], "]")
-		if len(sp2) != 2 || len(sp2[1]) != 0 {
-			return "", "", errors.New("Ill formed ENS name")
-		}
-		enskey = sp2[0]
-		textkey = sp1[0]
-	} else {
-		enskey = expr
-		textkey = ""
 	}
-	return enskey, textkey, nil
+	return true
 }
 
-func (s *Service) collectIPFS(expr, path string) {
-	log.Info("Collecting[ipfs] " + path + ">" + expr)
+// carry charges to q the hashes reached from the pinning manifest of ensname
+// in the last sync, if the manifest is unchanged, and keeps them without
+// marking. Returns false if they must be collected again.
+func (s *Service) carry(ensname, manifesthash, path string, manifest *PinningManifest, q *quota) bool {
 
-	// if information is available in local db, use it
-	hentry, _ := s.storage.Hash(expr)
-	if hentry != nil && !hentry.Dirty {
+	leaf, err := s.storage.Leaf(ensname)
+	if err != nil {
+		log.WithError(err).Warn("Failed to read leaf " + ensname)
+		return false
+	}
+	if leaf == nil || leaf.Manifest != manifesthash || leaf.Epoch+1 < s.epoch {
+		return false
+	}
 
-		log.WithField("hash", expr).Info("Already cached")
-		if hentry.Mark {
-			// if already marked, has been also already recursevlly marked
-			return
+	// manifests pinned in the other pin mode are collected again to migrate
+	for _, hash := range manifest.Pin {
+		hentry, err := s.storage.Hash(hash)
+		if err != nil || hentry == nil || hentry.Recursive != (s.PinMode == PinRecursive) {
+			return false
 		}
-		hentry.Mark = true
-		hentry.Dirty = false
+	}
 
-		if err := s.storage.UpdateHash(expr, hentry); err != nil {
-			log.WithError(err).Warn("Failed to update hash db")
-			s.stats.Errors++
-			return
-		}
-		for _, linkhash := range hentry.Links {
-			s.collectIPFS(linkhash, path+">"+expr+"()")
+	// the syncs that reuse the epoch can carry a leaf after a garbage
+	// collection unpinned its hashes, then they are collected again
+	for _, hash := range leaf.Hashes {
+		hentry, err := s.storage.Hash(hash)
+		if err != nil || hentry == nil || hentry.Dirty {
+			return false
 		}
-		return
 	}
 
-	// object is not in the database, so get data from it
-	start := time.Now()
-	err := s.ipfsc.IPFS().Pin(expr, false)
-	if err != nil {
-		log.WithError(err).Warn("Unable to get object " + expr)
-		s.stats.Errors++
-		return
+	for i, hash := range leaf.Hashes {
+		if !q.charge(hash, leaf.Sizes[i]) {
+			return false
+		}
 	}
 
-	s.stats.Pinned++
+	s.stat(func(stats *ServiceStats) {
+		stats.Count += len(manifest.Pin)
+		stats.Carried += len(leaf.Hashes)
+	})
+	for i, hash := range manifest.Pin {
+		s.reach(hash)
+		s.refer(hash, fmt.Sprintf("%v(#%v)", path, i), q)
+	}
+	for i, hash := range leaf.Hashes {
+		if !s.carried[hash] {
+			s.carried[hash] = true
+			s.kept[hash] = true
+			q.keep()
+		}
+		s.record(PlanKeep, hash, path, "", leaf.Sizes[i])
+	}
 
 	log.WithFields(log.Fields{
-		"hash": expr,
-		"time": time.Since(start),
-	}).Info("Pinned object")
-
-	ipfsObject, err := s.ipfsc.IPFS().ObjectGet(expr)
-	if err != nil {
-		log.WithError(err).Warn("Unable to get object " + expr)
-		s.stats.Errors++
-		return
-	}
+		"ensname": ensname,
+		"hashes":  len(leaf.Hashes),
+	}).Info("Manifest unchanged, carried over")
 
-	var links []string
-	if len(ipfsObject.Links) > 0 && ipfsObject.Links[0].Name != "" {
-		links = make([]string, len(ipfsObject.Links))
-		for i, link := range ipfsObject.Links {
-			links[i] = link.Hash
-			s.collectIPFS(link.Hash, path+">"+expr+"("+link.Name+")")
+	if leaf.Epoch != s.epoch {
+		leaf.Epoch = s.epoch
+		if err := s.storage.SetLeaf(ensname, leaf); err != nil {
+			log.WithError(err).Warn("Failed to update leaf " + ensname)
 		}
 	}
+	return true
+}
 
-	if err = s.storage.UpdateHash(expr, &sto.HashEntry{
-		DataSize: 0,
-		Links:    links,
-		Mark:     true,
-		Dirty:    false,
-	}); err != nil {
-		log.WithError(err).Warn("Failed to add hash " + expr)
-		s.stats.Errors++
-		return
+// pendingLeaf is a pinning manifest collected in the current sync, that is
+// stored when all its hashes are pinned.
+type pendingLeaf struct {
+	ensname      string
+	manifesthash string
+	q            *quota
+}
+
+// saveLeaf stores the hashes charged to q while collecting the pinning
+// manifest of ensname, to carry them over while the manifest is unchanged.
+func (s *Service) saveLeaf(ensname, manifesthash string, q *quota) {
+
+	leaf := &sto.LeafEntry{
+		Manifest: manifesthash,
+		Epoch:    s.epoch,
+		Hashes:   make([]string, 0, len(q.charged)),
+	}
+	for hash := range q.charged {
+		leaf.Hashes = append(leaf.Hashes, hash)
+	}
+	sort.Strings(leaf.Hashes)
+	for _, hash := range leaf.Hashes {
+		leaf.Sizes = append(leaf.Sizes, q.charged[hash])
 	}
 
-	return
+	if err := s.storage.SetLeaf(ensname, leaf); err != nil {
+		log.WithError(err).Warn("Failed to store leaf " + ensname)
+	}
 }
 
-func (s *Service) collect(expr, path string) {
+func (s *Service) collectContract(expr, path string, q *quota) {
 
-	s.stats.Count++
+	log.Info("Collecting[contract] " + path + ">" + expr)
 
-	if strings.HasPrefix(expr, "/ipfs/") {
-		s.collectIPFS(expr, path)
+	if !common.IsHexAddress(expr) {
+		log.Warn("Invalid contract address " + expr)
+		s.fail()
 		return
-	} else if strings.HasPrefix(expr, "0x") {
-		// handle contract, TODO
-	} else if strings.Contains(expr, ".eth") {
-		s.collectENS(expr, path)
+	}
+	address := common.HexToAddress(expr)
+
+	if !s.enter(address.Hex(), path) {
 		return
 	}
-	log.Warn("Unable to find resolver to sync '" + expr + "'")
-	s.stats.Errors++
-	return
-}
+	defer s.leave()
 
-func (s *Service) Sync(ensnames []string) (ServiceStats, error) {
+	source := address.Hex()
+	s.push(source)
+	defer s.pop()
 
-	s.laststats = s.stats
-	s.stats = ServiceStats{}
+	pins, err := s.readRegistry(address)
+	if err != nil {
+		log.WithError(err).Warn("Failed to read registry " + expr)
+		s.degrade(source, err, q)
+		return
+	}
 
-	var err error
+	for i, entry := range pins {
+		s.collect(entry, fmt.Sprintf("%v/%v(#%v)", path, expr, i), q)
+	}
+}
 
-	/* unmark all hashes */
-	err = s.storage.HashUpdateIter(func(_ string, entry *sto.HashEntry) *sto.HashEntry {
-		if entry.Mark {
-			entry.Mark = false
-			return entry
-		}
-		return nil
-	})
+func parseENSEntry(expr string) (enskey, textkey string, err error) {
+	if strings.Contains(expr, "[") {
+		sp1 := strings.Split(expr, "[")
+		if len(sp1) != 2 {
+			return "", "", errors.New("Ill formed ENS name")
+		}
+		sp2 := strings.Split(sp1[1], "]")
+		if len(sp2) != 2 || len(sp2[1]) != 0 {
+			return "", "", errors.New("Ill formed ENS name")
+		}
+		enskey = sp2[0]
+		textkey = sp1[0]
+	} else {
+		enskey = expr
+		textkey = ""
+	}
+	return enskey, textkey, nil
+}
 
+// collectIPFS collects the DAG of an IPFS object. The DAG is traversed with
+// a queue per consortium member stored in the db instead of recursively, so
+// memory does not grow with the size of the DAG and an interrupted traversal
+// can be resumed. The object is only queued, the DAGs of all the members are
+// traversed together once the roots are collected.
+func (s *Service) collectIPFS(expr, path string, q *quota) {
+	log.Info("Collecting[ipfs] " + path + ">" + expr)
+
+	s.path = path + ">" + expr
+	if s.PinMode == PinRecursive {
+		s.collectRecursive(expr, q)
+		return
+	}
+	s.enqueue(expr, "", q)
+}
+
+// enqueue adds an IPFS object to the traversal queue of the member of q.
+func (s *Service) enqueue(hash, parent string, q *quota) {
+	qentry := &sto.QueueEntry{
+		Hash:   hash,
+		Parent: parent,
+		Path:   s.path,
+	}
+	if q != nil {
+		qentry.Quota = uint64(q.index)
+	}
+	member := q.owner()
+	if err := s.storage.QueuePush(member, qentry); err != nil {
+		log.WithError(err).Warn("Failed to add " + hash + " to traversal queue")
+		s.fail()
+		return
+	}
+	for _, queued := range s.frontiers {
+		if queued == member {
+			return
+		}
+	}
+	s.frontiers = append(s.frontiers, member)
+}
+
+// traverse visits the objects in the traversal queues until they are empty,
+// storing the hashes pinned meanwhile. The members take turns to visit an
+// object, so a big DAG of a member does not delay the others, and the
+// objects visited and pinned are charged to the quota of their entries.
+func (s *Service) traverse(recovery bool) {
+	for len(s.frontiers) > 0 && !s.cancelled() {
+		member := s.frontiers[0]
+		s.frontiers = s.frontiers[1:]
+
+		qentry, err := s.storage.QueuePop(member)
+		if err != nil {
+			log.WithError(err).Warn("Failed to read traversal queue")
+			s.fail()
+			return
+		}
+		if qentry == nil {
+			continue
+		}
+		s.frontiers = append(s.frontiers, member)
+
+		var q *quota
+		if !recovery {
+			s.path = qentry.Path
+			if qentry.Quota > 0 {
+				q = s.quotas[qentry.Quota-1]
+			}
+		}
+		errs, failures := s.stats.Errors, s.failures
+		s.visitIPFS(qentry.Hash, qentry.Parent, q, recovery)
+		if s.stats.Errors != errs || s.failures != failures {
+			q.fail()
+		}
+		if s.stats.Errors != errs {
+			q.miss()
+		}
+
+		s.storePins(s.pool.done())
+		s.pool.throttle(maxPendingPins)
+	}
+}
+
+// visitIPFS marks and charges an IPFS object, pinning it if not cached, and
+// adds its links to the traversal queue. Both the named links of directories
+// and the unnamed links to the chunks of files are followed. On recovery the
+// objects are only pinned, and stored without marking.
+func (s *Service) visitIPFS(hash, parent string, q *quota, recovery bool) {
+	if parent != "" {
+		log.Debug("Collecting[ipfs] " + parent + ">" + hash)
+	}
+
+	// if information is available in local db, or is being pinned, use it
+	hentry, pending := s.pinning[hash]
+	if !pending {
+		hentry, _ = s.storage.Hash(hash)
+	}
+	cached := hentry != nil && !hentry.Dirty
+	if cached && recovery {
+		return
+	}
+
+	// objects pinned recursively are pinned again directly
+	demote := cached && hentry.Recursive
+	if cached && !demote {
+		if s.mark(hash, parent, hentry, pending, q) {
+			for _, link := range hentry.Links {
+				s.link(link, hash)
+				s.enqueue(link, hash, q)
+			}
+		}
+		return
+	}
+
+	// object is not in the database, so get data from it
+	if s.deferred(hash, q) {
+		return
+	}
+	member := q.owner()
+	ipfsObject, err := s.pool.object(member, hash)
+	if err != nil && s.cancelled() {
+		// visit it again when the traversal is resumed
+		s.enqueue(hash, parent, q)
+		return
+	}
 	if err != nil {
-		return s.stats, err
+		log.WithError(err).Warn("Unable to get object " + hash)
+		s.retry(hash, err, q)
+		return
 	}
 
-	/* discover, and mark hashes that needs to be pinned */
+	datasize := len(ipfsObject.Data)
+
+	// a file split in chunks is charged as a whole, so it is refused at once
+	// if it does not fit, and its chunks are not charged again
+	var links []string
+	size, chunked := uint64(datasize), len(ipfsObject.Links) > 0
+	for _, link := range ipfsObject.Links {
+		links = append(links, link.Hash)
+		size += uint64(link.Size)
+		chunked = chunked && link.Name == ""
+	}
+	if !chunked || q.seen(hash) {
+		size = uint64(datasize)
+	}
+	if !q.charge(hash, size) {
+		return
+	}
+	if chunked {
+		q.include(links)
+	}
+
+	// pin in background, the hash is stored when pinned
+	epoch := s.epoch
+	if recovery {
+		epoch = 0
+	}
+	s.pinning[hash] = &sto.HashEntry{
+		DataSize: uint(datasize),
+		Links:    links,
+		Epoch:    epoch,
+		Dirty:    false,
+	}
+	if demote {
+		s.demoting = append(s.demoting, hash)
+	} else {
+		s.pool.pin(member, hash, false)
+	}
+	s.record(PlanPin, hash, s.path, parent, uint64(datasize))
+
+	for _, link := range links {
+		s.link(link, hash)
+		s.prefetch(member, link)
+		s.enqueue(link, hash, q)
+	}
+}
+
+// link stores that an IPFS object is linked from the parent object, to find
+// why it is pinned.
+func (s *Service) link(hash, parent string) {
+	if err := s.storage.AddWhy(hash, &sto.WhyEntry{Parent: parent}); err != nil {
+		log.WithError(err).Warn("Failed to update why index")
+		s.fail()
+	}
+}
+
+// mark marks and charges to q a cached IPFS object, returns false if it was
+// already marked for q or q is exceeded.
+func (s *Service) mark(hash, parent string, hentry *sto.HashEntry, pending bool, q *quota) bool {
+
+	log.WithField("hash", hash).Debug("Already cached")
+	if hentry.Epoch == s.epoch && (q == nil || q.seen(hash)) {
+		// if already marked, has been also already marked its links
+		return false
+	}
+	if !q.charge(hash, uint64(hentry.DataSize)) {
+		return false
+	}
+	if hentry.Epoch != s.epoch {
+		hentry.Epoch = s.epoch
+		hentry.Dirty = false
+		hentry.MissedSince = 0
+		hentry.MissedSyncs = 0
+
+		// hashes being pinned are stored when pinned
+		if !pending {
+			if err := s.storage.UpdateHash(hash, hentry); err != nil {
+				log.WithError(err).Warn("Failed to update hash db")
+				s.fail()
+				return false
+			}
+		}
+		q.keep()
+	}
+	if !pending {
+		s.kept[hash] = true
+	}
+	s.record(PlanKeep, hash, s.path, parent, uint64(hentry.DataSize))
+	return true
+}
+
+// collectRecursive pins an IPFS object recursively, leaving its DAG to IPFS.
+// The object is charged with the cumulative size of the DAG, as stated by
+// the sizes of its links. Objects pinned directly by previous syncs are
+// pinned again recursively, and the pins of their links are collected as
+// garbage. Only the links of the object are stored as linked from it.
+func (s *Service) collectRecursive(hash string, q *quota) {
+
+	hentry, pending := s.pinning[hash]
+	if !pending {
+		hentry, _ = s.storage.Hash(hash)
+	}
+	if hentry != nil && !hentry.Dirty && hentry.Recursive {
+		if s.mark(hash, "", hentry, pending, q) {
+			for _, link := range hentry.Links {
+				s.link(link, hash)
+			}
+		}
+		return
+	}
+
+	if s.deferred(hash, q) {
+		return
+	}
+	member := q.owner()
+	ipfsObject, err := s.pool.object(member, hash)
+	if err != nil && s.cancelled() {
+		return
+	}
+	if err != nil {
+		log.WithError(err).Warn("Unable to get object " + hash)
+		s.retry(hash, err, q)
+		return
+	}
+
+	size := uint64(len(ipfsObject.Data))
+	var links []string
+	for _, link := range ipfsObject.Links {
+		size += uint64(link.Size)
+		links = append(links, link.Hash)
+	}
+	if !q.charge(hash, size) {
+		return
+	}
+
+	s.pinning[hash] = &sto.HashEntry{
+		DataSize:  uint(size),
+		Links:     links,
+		Epoch:     s.epoch,
+		Recursive: true,
+	}
+	s.pool.pin(member, hash, true)
+	s.record(PlanPin, hash, s.path, "", size)
+
+	for _, link := range links {
+		s.link(link, hash)
+	}
+}
+
+// demote pins directly the objects that were pinned recursively, once their
+// links are pinned directly, or keeps them pinned recursively if some pin
+// failed. If the object cannot be pinned again, it is stored as not pinned.
+func (s *Service) demote() {
+
+	ipfs := s.ipfs()
+	for _, hash := range s.demoting {
+		hentry := s.pinning[hash]
+		delete(s.pinning, hash)
+
+		if len(s.unpinned) > 0 || s.cancelled() {
+			// some links may be not pinned, keep the recursive pin marked
+			// until the next sync
+			if recursive, _ := s.storage.Hash(hash); recursive != nil {
+				recursive.Epoch = s.epoch
+				if err := s.storeHash(hash, recursive); err != nil {
+					log.WithError(err).Warn("Failed to update hash " + hash)
+					s.fail()
+				}
+			}
+			continue
+		}
+		if err := ipfs.Unpin(hash); err != nil {
+			log.WithError(err).Warn("Unable to unpin recursive object " + hash)
+			s.skip(hash, err, nil)
+			s.unpinned[hash] = true
+			continue
+		}
+		if err := ipfs.Pin(hash, false); err != nil {
+			log.WithError(err).Warn("Unable to pin object " + hash)
+			s.skip(hash, err, nil)
+			s.unpinned[hash] = true
+			hentry.Dirty = true
+		} else {
+			s.stat(func(stats *ServiceStats) {
+				stats.Pinned++
+			})
+			log.WithField("hash", hash).Info("Pinned object directly")
+		}
+
+		if err := s.storeHash(hash, hentry); err != nil {
+			log.WithError(err).Warn("Failed to update hash " + hash)
+			s.fail()
+		}
+	}
+	s.demoting = nil
+}
+
+// recover pins the objects left in the traversal queue by an interrupted
+// sync. They are stored unmarked, so they are kept only if the sync reaches
+// them again.
+func (s *Service) recover() {
+	pending, err := s.storage.QueueLen()
+	if err == nil && pending > 0 {
+		s.frontiers, err = s.storage.QueueMembers()
+	}
+	if err != nil {
+		log.WithError(err).Warn("Failed to read traversal queue")
+		s.fail()
+		return
+	}
+	if pending == 0 {
+		return
+	}
+	log.WithField("pending", pending).Info("Resuming interrupted traversal")
+	s.path = "(interrupted sync)"
+	s.traverse(true)
+	s.storePins(s.pool.wait())
+}
+
+// prefetch requests to get an IPFS object in background, if it is not cached
+// or waiting to be retried, and there are not too many objects already
+// requested.
+func (s *Service) prefetch(member, hash string) {
+	if s.pool.fetching() >= s.Workers*prefetchFactor {
+		return
+	}
+	if _, ok := s.pinning[hash]; ok {
+		return
+	}
+	if hentry, _ := s.storage.Hash(hash); hentry != nil && !hentry.Dirty {
+		return
+	}
+	if fentry, _ := s.storage.Failure(hash); fentry != nil && time.Now().Unix() < int64(fentry.NextRetry) {
+		return
+	}
+	s.pool.fetch(member, hash)
+}
+
+// storePins stores the hashes of the done pins.
+func (s *Service) storePins(pins []*poolJob) {
+	for _, job := range pins {
+		hentry := s.pinning[job.hash]
+
+		if job.err != nil && job.err == s.ctx.Err() {
+			delete(s.pinning, job.hash)
+			s.unpinned[job.hash] = true
+			continue
+		}
+		if job.err != nil {
+			log.WithError(job.err).Warn("Unable to pin object " + job.hash)
+			errs := s.stats.Errors
+			s.retry(job.hash, job.err, nil)
+			if s.stats.Errors != errs {
+				for _, q := range s.quotas {
+					if q.seen(job.hash) {
+						q.miss()
+					}
+				}
+			}
+			delete(s.pinning, job.hash)
+			s.unpinned[job.hash] = true
+			continue
+		}
+		delete(s.pinning, job.hash)
+		s.recovered(job.hash)
+
+		s.stat(func(stats *ServiceStats) {
+			stats.Pinned++
+		})
+		log.WithFields(log.Fields{
+			"hash": job.hash,
+			"size": hentry.DataSize,
+			"time": job.time,
+		}).Info("Pinned object")
+
+		if err := s.storeHash(job.hash, hentry); err != nil {
+			log.WithError(err).Warn("Failed to add hash " + job.hash)
+			s.fail()
+		}
+	}
+}
+
+// storeHash stores the entry of an IPFS hash that may change if it is pinned
+// or its size, updating the count and size of the pinned hashes, and the
+// hashes kept by the current sync.
+func (s *Service) storeHash(hash string, hentry *sto.HashEntry) error {
+
+	old, err := s.storage.Hash(hash)
+	if err != nil {
+		return err
+	}
+	if err := s.storage.UpdateHash(hash, hentry); err != nil {
+		return err
+	}
+	if old != nil && !old.Dirty {
+		s.pinnedCount--
+		s.pinnedSize -= old.DataSize
+	}
+	if hentry.Dirty {
+		delete(s.kept, hash)
+		return nil
+	}
+	s.pinnedCount++
+	s.pinnedSize += hentry.DataSize
+	if hentry.Epoch == s.epoch {
+		s.kept[hash] = true
+	}
+	return nil
+}
+
+// finishPins waits for the pins requested in the current sync, stores the
+// pinned hashes, and the pinning manifests with all their hashes pinned. If
+// the sync was cancelled the pinning manifests may be incomplete, and none
+// is stored.
+func (s *Service) finishPins() {
+
+	s.storePins(s.pool.wait())
+	s.demote()
+
+	if s.cancelled() {
+		s.leaves = nil
+		return
+	}
+
+	for _, leaf := range s.leaves {
+		complete := !leaf.q.failed && !leaf.q.exceeded()
+		for hash := range leaf.q.charged {
+			if s.unpinned[hash] {
+				complete = false
+				break
+			}
+		}
+		if complete {
+			s.saveLeaf(leaf.ensname, leaf.manifesthash, leaf.q)
+		}
+	}
+	s.leaves = nil
+}
+
+// refer stores that an IPFS hash is pinned from an ENS path of the root
+// being collected.
+func (s *Service) refer(hash, path string, q *quota) {
+	wentry := &sto.WhyEntry{
+		Root:   s.root,
+		Member: q.owner(),
+		Path:   path,
+		Epoch:  s.epoch,
+	}
+	if err := s.storage.AddWhy(hash, wentry); err != nil {
+		log.WithError(err).Warn("Failed to update why index")
+		s.fail()
+	}
+}
+
+func (s *Service) collect(expr, path string, q *quota) {
+
+	s.stat(func(stats *ServiceStats) {
+		stats.Count++
+	})
+
+	if strings.HasPrefix(expr, "/ipfs/") {
+		s.reach(expr)
+		s.refer(expr, path, q)
+		s.collectIPFS(expr, path, q)
+		return
+	} else if strings.HasPrefix(expr, "0x") {
+		s.collectContract(expr, path, q)
+		return
+	} else if strings.Contains(expr, ".eth") {
+		s.collectENS(expr, path, q)
+		return
+	}
+	log.Warn("Unable to find resolver to sync '" + expr + "'")
+	s.fail()
+	return
+}
+
+// begin resets the state for a new sync, that is stopped when ctx is
+// cancelled.
+func (s *Service) begin(ctx context.Context) {
+	s.ctx, s.cancel = context.WithCancel(ctx)
+	s.mutex.Lock()
+	s.laststats = s.stats
+	s.stats = ServiceStats{}
+	s.mutex.Unlock()
+	s.quotas = nil
+	s.texts = make(map[string]textResult)
+	s.manifests = make(map[string]manifestResult)
+	s.registries = make(map[string]textResults)
+	s.visiting = nil
+	s.sources = nil
+	s.reached = make(map[string]map[string]bool)
+	s.failed = make(map[string]bool)
+	s.scoped = 0
+	s.stales = nil
+	s.frontiers = nil
+	s.carried = make(map[string]bool)
+	s.kept = make(map[string]bool)
+	s.pool = newPinPool(s.ctx, s.ipfs(), s.Workers)
+	s.pinning = make(map[string]*sto.HashEntry)
+	s.unpinned = make(map[string]bool)
+	s.leaves = nil
+	s.demoting = nil
+	s.retrying = make(map[string]bool)
+	s.failures = 0
+	s.changed = nil
+}
+
+// cancelled returns if the current sync is being stopped.
+func (s *Service) cancelled() bool {
+	return s.ctx.Err() != nil
+}
+
+// collectRoots discovers and marks the hashes that needs to be pinned. If
+// the sync is cancelled, it stops after the objects being visited and waits
+// for the pins already requested, and the objects left in the traversal
+// queue are pinned by the next sync.
+func (s *Service) collectRoots(ensnames []string) {
+	s.recover()
 	for _, expr := range ensnames {
+		if s.cancelled() {
+			break
+		}
 		log.WithFields(log.Fields{
 			"expr": expr,
 		}).Info("Processing entries")
 
-		s.collect(expr, "")
+		s.root = expr
+		s.collect(expr, "", nil)
 	}
+	s.traverse(false)
+	s.finishPins()
+	s.reportStales()
+	if s.cancelled() {
+		log.Warn("Sync cancelled")
+		s.fail()
+		return
+	}
+	s.reportQuotas()
+	s.saveResolves()
+}
 
-	if s.stats.Errors == 0 {
-		/* No errors, unpin the unused hashes and mark as deleted */
-		err = s.storage.HashUpdateIter(func(hash string, entry *sto.HashEntry) *sto.HashEntry {
-			if !entry.Mark {
-				if err := s.ipfsc.IPFS().Unpin(hash); err != nil {
-					log.WithError(err).Warn("Failed to unpin " + hash)
-				}
-				s.stats.Unpinned++
-				entry.Dirty = true
-				return entry
-			}
-			return nil
-		})
+// SyncRoots collects and pins the content of some roots without unpinning
+// unused hashes, that is only done in a full Sync.
+func (s *Service) SyncRoots(ctx context.Context, ensnames []string) (ServiceStats, error) {
+	return s.syncRoots(ctx, ensnames, nil)
+}
+
+// SyncNames collects and pins the content reached from some ENS entries, like
+// "consortiumManifest[name.eth]", e.g. when their texts changed. Only the
+// manifests of the changed entries are read again, the other manifests of
+// their roots are taken from the cache, so the quotas of the roots are still
+// enforced. Like SyncRoots, unused hashes are not unpinned.
+func (s *Service) SyncNames(ctx context.Context, entries []string) (ServiceStats, error) {
 
+	changed := make(map[string]bool)
+	unique := make(map[string]bool)
+	for _, entry := range entries {
+		ensname, key, err := parseENSEntry(entry)
 		if err != nil {
-			s.stats.Errors++
+			return ServiceStats{}, err
+		}
+		if key == DefaultManifestKey {
+			changed[ensname] = true
+		}
+		for root := range s.names[entry] {
+			unique[root] = true
+		}
+	}
+	roots := make([]string, 0, len(unique))
+	for root := range unique {
+		roots = append(roots, root)
+	}
+	sort.Strings(roots)
+
+	log.WithFields(log.Fields{
+		"entries": entries,
+		"roots":   roots,
+	}).Info("Syncing changed ENS entries")
+	return s.syncRoots(ctx, roots, changed)
+}
+
+// syncRoots collects and pins the content of some roots, reading again only
+// the manifests of the changed ENS names if not nil.
+func (s *Service) syncRoots(ctx context.Context, ensnames []string, changed map[string]bool) (ServiceStats, error) {
+
+	s.begin(ctx)
+	defer s.cancel()
+	s.changed = changed
+
+	if err := s.loadEpoch(false); err != nil {
+		return s.stats, err
+	}
+	for _, root := range ensnames {
+		s.untrack(root)
+	}
+	s.collectRoots(ensnames)
+	if s.cancelled() {
+		return s.stats, s.ctx.Err()
+	}
+
+	if err := s.updateCurrentQuota(); err != nil {
+		s.fail()
+		return s.stats, err
+	}
+
+	return s.stats, nil
+}
+
+// Sync collects and pins the content of the roots, and unpins the unused
+// hashes. If ctx is cancelled, the sync stops as soon as the requests to
+// IPFS and ENS in course are done, and returns the error of ctx.
+func (s *Service) Sync(ctx context.Context, ensnames []string) (ServiceStats, error) {
+
+	s.begin(ctx)
+	defer s.cancel()
+	s.names = make(map[string]map[string]bool)
+
+	var err error
+
+	/* start a new epoch, so all hashes are unmarked */
+	if err = s.loadEpoch(true); err != nil {
+		return s.stats, err
+	}
+
+	/* discover, and mark hashes that needs to be pinned */
+	s.collectRoots(ensnames)
+	if s.cancelled() {
+		return s.stats, s.ctx.Err()
+	}
+
+	if s.stats.Errors == s.scoped {
+		/* No errors, or only in degraded sources whose hashes are kept, unpin
+		   the unused hashes and mark as deleted, if some is not kept */
+		if s.counted && s.pinnedCount == len(s.kept) {
+			log.WithField("pinned", s.pinnedCount).Info("All pinned hashes kept, nothing to collect")
+		} else if err = s.collectGarbage(); err != nil {
+			s.fail()
 			return s.stats, err
 		}
+		if err = s.storage.PurgeWhy(s.epoch); err != nil {
+			s.fail()
+			return s.stats, err
+		}
+		if err = s.storage.PurgeFailures(s.epoch); err != nil {
+			s.fail()
+			return s.stats, err
+		}
+	}
 
+	if err = s.updateCurrentQuota(); err != nil {
+		s.fail()
+		return s.stats, err
 	}
+
+	if err = s.updateMembers(); err != nil {
+		s.fail()
+		return s.stats, err
+	}
+
 	return s.stats, nil
 }
+
+// loadEpoch reads the epoch of the last sync, and starts a new one if next.
+func (s *Service) loadEpoch(next bool) error {
+
+	globals, err := s.storage.Globals()
+	if err != nil {
+		// globals not initialized yet
+		globals = &sto.GlobalsEntry{}
+	}
+	if globals.Epoch < firstEpoch-1 {
+		globals.Epoch = firstEpoch - 1
+	}
+	if next {
+		globals.Epoch++
+		if err := s.storage.SetGlobals(*globals); err != nil {
+			return err
+		}
+	}
+	s.epoch = globals.Epoch
+	return nil
+}
+
+// collectGarbage quarantines the unmarked hashes, and unpins them after they
+// have not been marked for more than GraceSyncs consecutive syncs or for
+// GracePeriod. The hashes left pinned are counted.
+func (s *Service) collectGarbage() error {
+
+	now := time.Now()
+
+	s.counted = false
+	pinnedCount, pinnedSize := 0, uint(0)
+	err := s.storage.HashUpdateIter(func(hash string, entry *sto.HashEntry) *sto.HashEntry {
+		if entry.Dirty {
+			return nil
+		}
+		if entry.Epoch == s.epoch || s.carried[hash] {
+			pinnedCount++
+			pinnedSize += entry.DataSize
+			return nil
+		}
+
+		since := now
+		if entry.MissedSince != 0 {
+			since = time.Unix(int64(entry.MissedSince), 0)
+		}
+		entry.MissedSyncs++
+
+		graced := s.GraceSyncs > 0 || s.GracePeriod > 0
+		if s.GraceSyncs > 0 && entry.MissedSyncs > s.GraceSyncs {
+			graced = false
+		}
+		if s.GracePeriod > 0 && now.Sub(since) >= s.GracePeriod {
+			graced = false
+		}
+
+		if graced {
+			if entry.MissedSince == 0 {
+				entry.MissedSince = uint64(now.Unix())
+			}
+			log.WithFields(log.Fields{
+				"hash":   hash,
+				"missed": entry.MissedSyncs,
+				"since":  since,
+			}).Info("Hash pending removal")
+			s.stat(func(stats *ServiceStats) {
+				stats.Quarantined++
+			})
+			s.record(PlanQuarantine, hash, "", "", uint64(entry.DataSize))
+			pinnedCount++
+			pinnedSize += entry.DataSize
+			return entry
+		}
+
+		if err := s.ipfs().Unpin(hash); err != nil {
+			log.WithError(err).Warn("Failed to unpin " + hash)
+		}
+		s.stat(func(stats *ServiceStats) {
+			stats.Unpinned++
+		})
+		s.record(PlanUnpin, hash, "", "", uint64(entry.DataSize))
+		for _, link := range entry.Links {
+			if err := s.storage.DeleteWhy(link, hash); err != nil {
+				log.WithError(err).Warn("Failed to update why index")
+			}
+		}
+		entry.Dirty = true
+		entry.MissedSince = 0
+		entry.MissedSyncs = 0
+		return entry
+	})
+	if err != nil {
+		return err
+	}
+	s.counted = true
+	s.pinnedCount, s.pinnedSize = pinnedCount, pinnedSize
+	return nil
+}
+
+// reportQuotas logs and adds to stats the quotas exceeded in the current sync.
+func (s *Service) reportQuotas() {
+	for _, q := range s.quotas {
+		violation := q.violation()
+		if violation == nil {
+			continue
+		}
+		log.WithFields(log.Fields{
+			"name":   violation.Name,
+			"quotum": violation.Quotum,
+			"used":   violation.Used,
+			"over":   violation.Over,
+		}).Warn("Quota exceeded")
+		s.stat(func(stats *ServiceStats) {
+			stats.QuotaViolations = append(stats.QuotaViolations, *violation)
+		})
+	}
+}
+
+// updateCurrentQuota stores the size of all pinned hashes in the globals.
+// The pinned hashes are only counted if no garbage collection counted them.
+func (s *Service) updateCurrentQuota() error {
+
+	if !s.counted {
+		pinnedCount, pinnedSize := 0, uint(0)
+		err := s.storage.HashUpdateIter(func(_ string, entry *sto.HashEntry) *sto.HashEntry {
+			if !entry.Dirty {
+				pinnedCount++
+				pinnedSize += entry.DataSize
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		s.counted = true
+		s.pinnedCount, s.pinnedSize = pinnedCount, pinnedSize
+	}
+	datasize := s.pinnedSize
+
+	globals, err := s.storage.Globals()
+	if err != nil {
+		// globals not initialized yet
+		globals = &sto.GlobalsEntry{}
+	}
+	globals.CurrentQuota = datasize
+	s.stat(func(stats *ServiceStats) {
+		stats.DataSize = uint64(datasize)
+	})
+
+	return s.storage.SetGlobals(*globals)
+}
+
+// updateMembers stores the usage of the consortium members reached in the
+// current sync, and removes the members that are no longer reached. Content
+// shared by several members is fully accounted to each one of them. The
+// members whose usage is incomplete because of errors keep their last usage,
+// and with errors no member is removed since it may be just unreachable.
+func (s *Service) updateMembers() error {
+
+	usage := make(map[string]map[string]uint64)
+	incomplete := make(map[string]bool)
+	for _, q := range s.quotas {
+		if !q.member {
+			continue
+		}
+		if q.incomplete {
+			incomplete[q.name] = true
+		}
+		hashes, ok := usage[q.name]
+		if !ok {
+			hashes = make(map[string]uint64)
+			usage[q.name] = hashes
+		}
+		for hash, size := range q.charged {
+			hashes[hash] = size
+		}
+	}
+
+	members, err := s.storage.Members()
+	if err != nil {
+		return err
+	}
+	known := make(map[string]bool)
+	for _, member := range members {
+		known[member] = true
+		if _, ok := usage[member]; !ok && s.stats.Errors == 0 {
+			log.WithField("member", member).Info("Member removed from consortium")
+			if err := s.storage.RemoveMember(member); err != nil {
+				return err
+			}
+		}
+	}
+
+	for member, hashes := range usage {
+		if incomplete[member] {
+			log.WithField("member", member).Warn("Member not updated, some of its sources failed")
+			continue
+		}
+		if !known[member] {
+			log.WithField("member", member).Info("New consortium member")
+			if err := s.storage.AddMember(member); err != nil {
+				return err
+			}
+		}
+		entry := sto.MemberEntry{HashCount: uint(len(hashes))}
+		for _, size := range hashes {
+			entry.DataSize += uint(size)
+		}
+		if err := s.storage.UpdateMember(member, &entry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
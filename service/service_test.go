@@ -1,14 +1,18 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	shell "github.com/adriamb/go-ipfs-api"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ipfsconsortium/go-ipfsc/storage"
 	"github.com/stretchr/testify/assert"
 )
@@ -19,14 +23,20 @@ type IPFSEntry struct {
 }
 
 type IPFSMock struct {
-	dag map[string]*shell.IpfsObject
-	pin map[string]bool
+	sync.Mutex
+	dag       map[string]*shell.IpfsObject
+	pin       map[string]bool
+	recursive map[string]bool
+
+	// onGet is called when an object is got, if set
+	onGet func(path string)
 }
 
 func NewIPFSMock() *IPFSMock {
 	return &IPFSMock{
-		make(map[string]*shell.IpfsObject),
-		make(map[string]bool),
+		dag:       make(map[string]*shell.IpfsObject),
+		pin:       make(map[string]bool),
+		recursive: make(map[string]bool),
 	}
 }
 
@@ -76,7 +86,28 @@ func (m *IPFSMock) addFolderEntry(link1, link2 string) string {
 	return ipfshash
 }
 
+func (m *IPFSMock) addChunkedEntry(chunks ...string) string {
+	ipfshash := "/ipfs/{" + strings.Join(chunks, "+") + "}"
+	links := make([]shell.ObjectLink, len(chunks))
+	for i, chunk := range chunks {
+		links[i] = shell.ObjectLink{Name: "", Hash: chunk, Size: 1}
+		if entry := m.dag[chunk]; entry != nil {
+			links[i].Size = uint64(len(entry.Data))
+		}
+	}
+	m.dag[ipfshash] = &shell.IpfsObject{
+		Data:  "file",
+		Links: links,
+	}
+	return ipfshash
+}
+
 func (m *IPFSMock) ObjectGet(path string) (*shell.IpfsObject, error) {
+	if m.onGet != nil {
+		m.onGet(path)
+	}
+	m.Lock()
+	defer m.Unlock()
 	entry, ok := m.dag[path]
 	if !ok || entry == nil {
 		return nil, errors.New("Invalid path")
@@ -85,20 +116,27 @@ func (m *IPFSMock) ObjectGet(path string) (*shell.IpfsObject, error) {
 }
 
 func (m *IPFSMock) Pin(path string, recursive bool) error {
+	m.Lock()
+	defer m.Unlock()
 	entry, ok := m.dag[path]
 	if !ok || entry == nil {
 		return errors.New("Invalid path")
 	}
 	m.pin[path] = true
+	m.recursive[path] = recursive
 	return nil
 }
 
 func (m *IPFSMock) isPinned(path string) bool {
+	m.Lock()
+	defer m.Unlock()
 	yes, ok := m.pin[path]
 	return yes && ok
 }
 
 func (m *IPFSMock) Unpin(path string) error {
+	m.Lock()
+	defer m.Unlock()
 	_, ok := m.dag[path]
 	if !ok {
 		return errors.New("Invalid path")
@@ -109,11 +147,14 @@ func (m *IPFSMock) Unpin(path string) error {
 
 type ENSMock struct {
 	entries map[string]string
+	reads   map[string]int
+	block   uint64
 }
 
 func NewENSMock() *ENSMock {
 	return &ENSMock{
 		entries: make(map[string]string),
+		reads:   make(map[string]int),
 	}
 }
 
@@ -122,7 +163,12 @@ func (m *ENSMock) Info(name string) (string, error) {
 	return fmt.Sprint("ENS ", name, " exists = ", ok), nil
 }
 
-func (m *ENSMock) Text(name, key string) (string, error) {
+func (m *ENSMock) Resolver(ctx context.Context, name string) (common.Address, error) {
+	return common.HexToAddress("0x5ffc014343cd971b7eb70732021e26c35b744cc4"), nil
+}
+
+func (m *ENSMock) Text(ctx context.Context, name, key string) (string, error) {
+	m.reads[name+":"+key]++
 	text, ok := m.entries[name+":"+key]
 	if !ok {
 		return "", errors.New("Undefined ENS key")
@@ -131,15 +177,43 @@ func (m *ENSMock) Text(name, key string) (string, error) {
 
 }
 
+func (m *ENSMock) BlockNumber(ctx context.Context) (uint64, error) {
+	return m.block, nil
+}
+
 func (m *ENSMock) SetText(name, key, text string) error {
 	m.entries[name+":"+key] = text
 	return nil
 }
 
+type RegistryMock struct {
+	registries map[common.Address][]string
+}
+
+func NewRegistryMock() *RegistryMock {
+	return &RegistryMock{
+		registries: make(map[common.Address][]string),
+	}
+}
+
+func (m *RegistryMock) Pins(ctx context.Context, address common.Address) ([]string, error) {
+	pins, ok := m.registries[address]
+	if !ok {
+		return nil, errors.New("Undefined registry")
+	}
+	return pins, nil
+}
+
 func createMockService(t *testing.T) (service *Service, ipfs *IPFSMock, ens *ENSMock) {
+	service, ipfs, ens, _ = createMockServiceWithRegistry(t)
+	return service, ipfs, ens
+}
+
+func createMockServiceWithRegistry(t *testing.T) (service *Service, ipfs *IPFSMock, ens *ENSMock, registry *RegistryMock) {
 	ipfs = NewIPFSMock()
 	ens = NewENSMock()
-	ipfsc := NewIPFSCClient(ipfs, ens)
+	registry = NewRegistryMock()
+	ipfsc := NewIPFSCClient(ipfs, ens, registry)
 
 	tmp, err := ioutil.TempDir("", "dbtest")
 	assert.Nil(t, err)
@@ -150,7 +224,7 @@ func createMockService(t *testing.T) (service *Service, ipfs *IPFSMock, ens *ENS
 	})
 	assert.Nil(t, err)
 
-	return NewService(ipfsc, s), ipfs, ens
+	return NewService(ipfsc, s), ipfs, ens, registry
 }
 
 func TestPinningSync(t *testing.T) {
@@ -160,10 +234,10 @@ func TestPinningSync(t *testing.T) {
 
 	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h1, h2}})
 
-	err := s.Sync([]string{"set1.eth"})
-	assert.Equal(t, 2, s.pinned)
-	assert.Equal(t, 0, s.unpinned)
-	assert.Equal(t, 0, s.errors)
+	stats, err := s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Equal(t, 2, stats.Pinned)
+	assert.Equal(t, 0, stats.Unpinned)
+	assert.Equal(t, 0, stats.Errors)
 	assert.Nil(t, err)
 
 	assert.True(t, ipfs.isPinned(h1))
@@ -186,10 +260,10 @@ func TestConsortiumSync(t *testing.T) {
 		},
 	})
 
-	err := s.Sync([]string{"consortium.eth"})
-	assert.Equal(t, 3, s.pinned)
-	assert.Equal(t, 0, s.unpinned)
-	assert.Equal(t, 0, s.errors)
+	stats, err := s.Sync(context.Background(), []string{"consortium.eth"})
+	assert.Equal(t, 3, stats.Pinned)
+	assert.Equal(t, 0, stats.Unpinned)
+	assert.Equal(t, 0, stats.Errors)
 	assert.Nil(t, err)
 
 	assert.True(t, ipfs.isPinned(h1))
@@ -197,6 +271,61 @@ func TestConsortiumSync(t *testing.T) {
 	assert.True(t, ipfs.isPinned(h3))
 }
 
+func TestMemberTurns(t *testing.T) {
+	s, ipfs, _ := createMockService(t)
+
+	// a tree of 31 objects for big.eth, and 3 objects for small.eth
+	var level []string
+	for i := 0; i < 16; i++ {
+		level = append(level, ipfs.addFileEntry(fmt.Sprintf("a%v", i)))
+	}
+	for len(level) > 1 {
+		var next []string
+		for i := 0; i < len(level); i += 2 {
+			next = append(next, ipfs.addFolderEntry(level[i], level[i+1]))
+		}
+		level = next
+	}
+	big := level[0]
+	b1 := ipfs.addFileEntry("b1")
+	b2 := ipfs.addFileEntry("b2")
+	small := ipfs.addFolderEntry(b1, b2)
+
+	s.ipfsc.WritePinningManifest("big.eth", &PinningManifest{Pin: []string{big}})
+	s.ipfsc.WritePinningManifest("small.eth", &PinningManifest{Pin: []string{small}})
+	s.ipfsc.WriteConsortiumManifest("consortium.eth", &ConsortiumManifest{
+		Members: []ConsortiumMember{
+			ConsortiumMember{EnsName: "big.eth"},
+			ConsortiumMember{EnsName: "small.eth"},
+		},
+	})
+
+	var mutex sync.Mutex
+	var order []string
+	ipfs.onGet = func(path string) {
+		mutex.Lock()
+		order = append(order, path)
+		mutex.Unlock()
+	}
+
+	stats, err := s.Sync(context.Background(), []string{"consortium.eth"})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, stats.Errors)
+	assert.Equal(t, 34, stats.Pinned)
+
+	// the objects of small.eth are got while the tree of big.eth is walked
+	lastsmall, lastbig := -1, -1
+	for i, path := range order {
+		if path == small || path == b1 || path == b2 {
+			lastsmall = i
+		} else {
+			lastbig = i
+		}
+	}
+	assert.Equal(t, 34, len(order))
+	assert.True(t, lastsmall < lastbig/2, "small.eth done at %v of %v", lastsmall, lastbig)
+}
+
 func TestDirSync(t *testing.T) {
 	s, ipfs, _ := createMockService(t)
 	h11 := ipfs.addFileEntry("h11")
@@ -206,10 +335,10 @@ func TestDirSync(t *testing.T) {
 	h1 := ipfs.addFolderEntry(h11, h12)
 
 	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h1}})
-	err := s.Sync([]string{"set1.eth"})
-	assert.Equal(t, 5, s.pinned)
-	assert.Equal(t, 0, s.unpinned)
-	assert.Equal(t, 0, s.errors)
+	stats, err := s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Equal(t, 5, stats.Pinned)
+	assert.Equal(t, 0, stats.Unpinned)
+	assert.Equal(t, 0, stats.Errors)
 	assert.Nil(t, err)
 
 	assert.True(t, ipfs.isPinned(h1))
@@ -219,6 +348,245 @@ func TestDirSync(t *testing.T) {
 	assert.True(t, ipfs.isPinned(h122))
 }
 
+func TestChunkedFileSync(t *testing.T) {
+	s, ipfs, _ := createMockService(t)
+	c1 := ipfs.addFileEntry("c1")
+	c2 := ipfs.addFileEntry("c2")
+	f1 := ipfs.addChunkedEntry(c1, c2)
+	h2 := ipfs.addFileEntry("h2")
+	h1 := ipfs.addFolderEntry(f1, h2)
+
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h1}})
+	stats, err := s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Equal(t, 5, stats.Pinned)
+	assert.Equal(t, 0, stats.Errors)
+	assert.Nil(t, err)
+
+	assert.True(t, ipfs.isPinned(f1))
+	assert.True(t, ipfs.isPinned(c1))
+	assert.True(t, ipfs.isPinned(c2))
+
+	hentry, err := s.storage.Hash(f1)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{c1, c2}, hentry.Links)
+}
+
+func TestChunkedFileQuota(t *testing.T) {
+	s, ipfs, _ := createMockService(t)
+	c1 := ipfs.addFileEntry("c1")
+	c2 := ipfs.addFileEntry("c2")
+	f1 := ipfs.addChunkedEntry(c1, c2)
+	h1 := ipfs.addFileEntry("h1")
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{f1, h1}})
+
+	// the file is 8 bytes, its root node only 4
+	s.ipfsc.WriteConsortiumManifest("consortium.eth", &ConsortiumManifest{
+		Members: []ConsortiumMember{
+			ConsortiumMember{EnsName: "set1.eth", Quotum: "6"},
+		},
+	})
+
+	stats, err := s.Sync(context.Background(), []string{"consortium.eth"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, stats.Pinned)
+	assert.False(t, ipfs.isPinned(f1))
+	assert.False(t, ipfs.isPinned(c1))
+	assert.False(t, ipfs.isPinned(c2))
+	assert.True(t, ipfs.isPinned(h1))
+
+	assert.Equal(t, 1, len(stats.QuotaViolations))
+	assert.Equal(t, uint64(2), stats.QuotaViolations[0].Used)
+	assert.Equal(t, uint64(4), stats.QuotaViolations[0].Over)
+
+	// with room for it, the file is charged once with its chunks
+	s.ipfsc.WriteConsortiumManifest("consortium.eth", &ConsortiumManifest{
+		Members: []ConsortiumMember{
+			ConsortiumMember{EnsName: "set1.eth", Quotum: "10"},
+		},
+	})
+	stats, err = s.Sync(context.Background(), []string{"consortium.eth"})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(stats.QuotaViolations))
+	assert.True(t, ipfs.isPinned(f1))
+	assert.True(t, ipfs.isPinned(c1))
+	assert.True(t, ipfs.isPinned(c2))
+
+	m, err := s.storage.Member("set1.eth")
+	assert.Nil(t, err)
+	assert.Equal(t, uint(10), m.DataSize)
+}
+
+func TestResumeTraversal(t *testing.T) {
+	s, ipfs, _ := createMockService(t)
+	c1 := ipfs.addFileEntry("c1")
+	c2 := ipfs.addFileEntry("c2")
+	f1 := ipfs.addChunkedEntry(c1, c2)
+	orphan := ipfs.addFileEntry("orphan")
+
+	// objects left in the queue by an interrupted sync
+	assert.Nil(t, s.storage.QueuePush("", &storage.QueueEntry{Hash: c2, Parent: f1, Quota: 1}))
+	assert.Nil(t, s.storage.QueuePush("set2.eth", &storage.QueueEntry{Hash: orphan, Quota: 1}))
+
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{f1}})
+	stats, err := s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Equal(t, 4, stats.Pinned)
+	assert.Equal(t, 1, stats.Unpinned)
+	assert.Equal(t, 0, stats.Errors)
+	assert.Nil(t, err)
+
+	assert.True(t, ipfs.isPinned(f1))
+	assert.True(t, ipfs.isPinned(c1))
+	assert.True(t, ipfs.isPinned(c2))
+	assert.False(t, ipfs.isPinned(orphan))
+
+	pending, err := s.storage.QueueLen()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, pending)
+}
+
+func TestCancelledSync(t *testing.T) {
+	s, ipfs, _ := createMockService(t)
+	h1 := ipfs.addFileEntry("h1")
+	h2 := ipfs.addFileEntry("h2")
+
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h1}})
+	_, err := s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Nil(t, err)
+
+	// a cancelled sync does not pin nor unpin
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h2}})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	stats, err := s.Sync(ctx, []string{"set1.eth"})
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 0, stats.Pinned)
+	assert.Equal(t, 0, stats.Unpinned)
+	assert.True(t, ipfs.isPinned(h1))
+	assert.False(t, ipfs.isPinned(h2))
+
+	stats, err = s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, stats.Pinned)
+	assert.Equal(t, 1, stats.Unpinned)
+	assert.False(t, ipfs.isPinned(h1))
+	assert.True(t, ipfs.isPinned(h2))
+}
+
+func TestCancelledTraversal(t *testing.T) {
+	s, ipfs, _ := createMockService(t)
+	h11 := ipfs.addFileEntry("h11")
+	h12 := ipfs.addFileEntry("h12")
+	h1 := ipfs.addFolderEntry(h11, h12)
+
+	// cancel the sync while the folder is being got
+	ctx, cancel := context.WithCancel(context.Background())
+	ipfs.onGet = func(path string) {
+		if path == h1 {
+			cancel()
+		}
+	}
+
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h1}})
+	_, err := s.Sync(ctx, []string{"set1.eth"})
+	assert.Equal(t, context.Canceled, err)
+
+	pending, err := s.storage.QueueLen()
+	assert.Nil(t, err)
+	assert.NotEqual(t, 0, pending)
+
+	// the next sync resumes the traversal
+	ipfs.onGet = nil
+	stats, err := s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, stats.Errors)
+	assert.True(t, ipfs.isPinned(h1))
+	assert.True(t, ipfs.isPinned(h11))
+	assert.True(t, ipfs.isPinned(h12))
+
+	pending, err = s.storage.QueueLen()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, pending)
+}
+
+func TestRecursiveSync(t *testing.T) {
+	s, ipfs, _ := createMockService(t)
+	s.PinMode = PinRecursive
+	h11 := ipfs.addFileEntry("h11")
+	h121 := ipfs.addFileEntry("h121")
+	h122 := ipfs.addFileEntry("h122")
+	h12 := ipfs.addFolderEntry(h121, h122)
+	h1 := ipfs.addFolderEntry(h11, h12)
+
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h1}})
+	stats, err := s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Equal(t, 1, stats.Pinned)
+	assert.Equal(t, 0, stats.Errors)
+	assert.Nil(t, err)
+
+	assert.True(t, ipfs.isPinned(h1))
+	assert.True(t, ipfs.recursive[h1])
+	assert.False(t, ipfs.isPinned(h11))
+
+	hentry, err := s.storage.Hash(h1)
+	assert.Nil(t, err)
+	assert.True(t, hentry.Recursive)
+	assert.Equal(t, uint(2), hentry.DataSize)
+	assert.Equal(t, []string{h11, h12}, hentry.Links)
+
+	hentry, err = s.storage.Hash(h11)
+	assert.Nil(t, err)
+	assert.Nil(t, hentry)
+}
+
+func TestPinModeMigration(t *testing.T) {
+	s, ipfs, _ := createMockService(t)
+	h11 := ipfs.addFileEntry("h11")
+	h121 := ipfs.addFileEntry("h121")
+	h122 := ipfs.addFileEntry("h122")
+	h12 := ipfs.addFolderEntry(h121, h122)
+	h1 := ipfs.addFolderEntry(h11, h12)
+
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h1}})
+	stats, err := s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Equal(t, 5, stats.Pinned)
+	assert.Nil(t, err)
+
+	// direct to recursive, the links are unpinned
+	s.PinMode = PinRecursive
+	stats, err = s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Equal(t, 1, stats.Pinned)
+	assert.Equal(t, 4, stats.Unpinned)
+	assert.Equal(t, 0, stats.Carried)
+	assert.Equal(t, 0, stats.Errors)
+	assert.Nil(t, err)
+	assert.True(t, ipfs.isPinned(h1))
+	assert.True(t, ipfs.recursive[h1])
+	assert.False(t, ipfs.isPinned(h121))
+
+	// recursive to direct, the links are pinned again
+	s.PinMode = PinDirect
+	stats, err = s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Equal(t, 5, stats.Pinned)
+	assert.Equal(t, 0, stats.Unpinned)
+	assert.Equal(t, 0, stats.Carried)
+	assert.Equal(t, 0, stats.Errors)
+	assert.Nil(t, err)
+	assert.True(t, ipfs.isPinned(h1))
+	assert.False(t, ipfs.recursive[h1])
+	assert.True(t, ipfs.isPinned(h121))
+
+	hentry, err := s.storage.Hash(h1)
+	assert.Nil(t, err)
+	assert.False(t, hentry.Recursive)
+	assert.Equal(t, 2, len(hentry.Links))
+
+	// unchanged manifest in the same mode is carried over
+	stats, err = s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Equal(t, 0, stats.Pinned)
+	assert.Equal(t, 5, stats.Carried)
+	assert.Nil(t, err)
+}
+
 func TestUpdateSimple(t *testing.T) {
 	s, ipfs, _ := createMockService(t)
 	h1 := ipfs.addFileEntry("h1")
@@ -226,17 +594,17 @@ func TestUpdateSimple(t *testing.T) {
 	h3 := ipfs.addFileEntry("h3")
 
 	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h1, h2}})
-	err := s.Sync([]string{"set1.eth"})
-	assert.Equal(t, 2, s.pinned)
-	assert.Equal(t, 0, s.unpinned)
-	assert.Equal(t, 0, s.errors)
+	stats, err := s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Equal(t, 2, stats.Pinned)
+	assert.Equal(t, 0, stats.Unpinned)
+	assert.Equal(t, 0, stats.Errors)
 	assert.Nil(t, err)
 
 	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h2, h3}})
-	err = s.Sync([]string{"set1.eth"})
-	assert.Equal(t, 1, s.pinned)
-	assert.Equal(t, 1, s.unpinned)
-	assert.Equal(t, 0, s.errors)
+	stats, err = s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Equal(t, 1, stats.Pinned)
+	assert.Equal(t, 1, stats.Unpinned)
+	assert.Equal(t, 0, stats.Errors)
 	assert.Nil(t, err)
 
 	assert.False(t, ipfs.isPinned(h1))
@@ -266,16 +634,16 @@ func TestUpdateSharedBranches(t *testing.T) {
 
 	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h1}})
 	s.ipfsc.WritePinningManifest("set2.eth", &PinningManifest{Pin: []string{h2}})
-	err := s.Sync([]string{"set1.eth", "set2.eth"})
-	assert.Equal(t, 7, s.pinned)
-	assert.Equal(t, 0, s.unpinned)
-	assert.Equal(t, 0, s.errors)
+	stats, err := s.Sync(context.Background(), []string{"set1.eth", "set2.eth"})
+	assert.Equal(t, 7, stats.Pinned)
+	assert.Equal(t, 0, stats.Unpinned)
+	assert.Equal(t, 0, stats.Errors)
 	assert.Nil(t, err)
 
-	err = s.Sync([]string{"set1.eth"})
-	assert.Equal(t, 0, s.pinned)
-	assert.Equal(t, 2, s.unpinned)
-	assert.Equal(t, 0, s.errors)
+	stats, err = s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Equal(t, 0, stats.Pinned)
+	assert.Equal(t, 2, stats.Unpinned)
+	assert.Equal(t, 0, stats.Errors)
 	assert.Nil(t, err)
 
 	assert.True(t, ipfs.isPinned(h1))
@@ -295,40 +663,1050 @@ func TestNounpinWhenFail(t *testing.T) {
 	hfail := ipfs.addFailingEntry("fail1")
 
 	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h1, h2}})
-	err := s.Sync([]string{"set1.eth"})
-	assert.Equal(t, 0, s.errors)
+	stats, err := s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Equal(t, 0, stats.Errors)
 	assert.Nil(t, err)
 
 	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h1, hfail, h3}})
-	err = s.Sync([]string{"set1.eth"})
-	assert.Equal(t, 1, s.pinned)
-	assert.Equal(t, 0, s.unpinned)
-	assert.Equal(t, 1, s.errors)
+	stats, err = s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Equal(t, 1, stats.Pinned)
+	assert.Equal(t, 0, stats.Unpinned)
+	assert.Equal(t, 1, stats.Errors)
+	assert.Equal(t, []DegradedSource{{Source: hfail, Error: "Invalid path", Blocking: true}}, stats.Degraded)
 	assert.Nil(t, err)
+	assert.True(t, ipfs.isPinned(h2))
 }
 
-func TestReappearHash(t *testing.T) {
+func TestNounpinWhenNeverResolved(t *testing.T) {
+	s, ipfs, _ := createMockService(t)
+	h1 := ipfs.addFileEntry("h1")
+	h2 := ipfs.addFileEntry("h2")
+	h3 := ipfs.addFileEntry("h3")
+
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h1, h2}})
+	stats, err := s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Equal(t, 0, stats.Errors)
+	assert.Nil(t, err)
+
+	// unknown.eth was never resolved, so it may reach h2
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h1, "unknown.eth", h3}})
+	stats, err = s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Equal(t, 1, stats.Pinned)
+	assert.Equal(t, 0, stats.Unpinned)
+	assert.Equal(t, 1, stats.Errors)
+	assert.Equal(t, 1, len(stats.Degraded))
+	assert.True(t, stats.Degraded[0].Blocking)
+	assert.Nil(t, err)
+	assert.True(t, ipfs.isPinned(h2))
+}
+
+func TestScopedGCWhenHashFails(t *testing.T) {
 	s, ipfs, _ := createMockService(t)
 	h1 := ipfs.addFileEntry("h1")
+	h21 := ipfs.addFileEntry("h21")
+	h22 := ipfs.addFileEntry("h22")
+	h2 := ipfs.addFolderEntry(h21, h22)
+	h3 := ipfs.addFileEntry("h3")
+
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h2}})
+	s.ipfsc.WritePinningManifest("set2.eth", &PinningManifest{Pin: []string{h21, h3}})
+	stats, err := s.Sync(context.Background(), []string{"set1.eth", "set2.eth"})
+	assert.Nil(t, err)
+	assert.Equal(t, 4, stats.Pinned)
 
 	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h1}})
-	err := s.Sync([]string{"set1.eth"})
-	assert.Equal(t, 0, s.errors)
-	assert.Equal(t, 1, s.pinned)
-	assert.Equal(t, 0, s.unpinned)
+	stats, err = s.Sync(context.Background(), []string{"set1.eth", "set2.eth"})
 	assert.Nil(t, err)
+	assert.Equal(t, 2, stats.Unpinned)
 
-	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{}})
-	err = s.Sync([]string{"set1.eth"})
-	assert.Equal(t, 0, s.errors)
-	assert.Equal(t, 0, s.pinned)
-	assert.Equal(t, 1, s.unpinned)
+	// h2 cannot be fetched again, the links it had are kept and the rest of
+	//   the garbage is collected
+	ipfs.dag[h2] = nil
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h1, h2}})
+	s.ipfsc.WritePinningManifest("set2.eth", &PinningManifest{})
+	stats, err = s.Sync(context.Background(), []string{"set1.eth", "set2.eth"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, stats.Errors)
+	assert.Equal(t, []DegradedSource{{Source: h2, Error: "Invalid path", Protected: 1}}, stats.Degraded)
+	assert.Equal(t, 1, stats.Unpinned)
+	assert.True(t, ipfs.isPinned(h21))
+	assert.False(t, ipfs.isPinned(h3))
+	assert.True(t, ipfs.isPinned(h1))
+}
+
+func TestStatsCopy(t *testing.T) {
+	s, _, _ := createMockService(t)
+	s.degraded(DegradedSource{Source: "set1.eth"})
+
+	// the stats returned do not change with the stats of the sync
+	current, _ := s.Stats()
+	s.stat(func(stats *ServiceStats) {
+		stats.Degraded[0].Protected = 1
+	})
+	assert.Equal(t, 0, current.Degraded[0].Protected)
+}
+
+func TestRetryBackoff(t *testing.T) {
+	s, ipfs, _ := createMockService(t)
+	s.RetryDelay = time.Hour
+	h1 := ipfs.addFileEntry("h1")
+	hfail := ipfs.addFailingEntry("fail1")
+
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h1, hfail}})
+	stats, err := s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Equal(t, 1, stats.Pinned)
+	assert.Equal(t, 1, stats.Errors)
+	assert.Nil(t, err)
+
+	fentry, err := s.storage.Failure(hfail)
+	assert.Nil(t, err)
+	assert.Equal(t, uint(1), fentry.Failures)
+	assert.Equal(t, "Invalid path", fentry.LastError)
+	assert.True(t, fentry.NextRetry > uint64(time.Now().Unix()))
+
+	// not retried before the delay
+	stats, err = s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Equal(t, 1, stats.Deferred)
+	assert.Equal(t, 1, stats.Errors)
+	assert.Equal(t, 1, len(stats.Degraded))
+	assert.Contains(t, stats.Degraded[0].Error, "retry deferred")
+	assert.Nil(t, err)
+
+	// retried after the delay
+	ipfs.dag[hfail] = &shell.IpfsObject{Data: "fail1"}
+	fentry.NextRetry = 0
+	assert.Nil(t, s.storage.SetFailure(hfail, fentry))
+	stats, err = s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Equal(t, 1, stats.Pinned)
+	assert.Equal(t, 0, stats.Errors)
+	assert.Nil(t, err)
+	assert.True(t, ipfs.isPinned(hfail))
+
+	fentry, err = s.storage.Failure(hfail)
 	assert.Nil(t, err)
+	assert.Nil(t, fentry)
+}
+
+func TestPermanentFailure(t *testing.T) {
+	s, ipfs, _ := createMockService(t)
+	s.RetryDelay = 0
+	s.MaxRetries = 2
+	h1 := ipfs.addFileEntry("h1")
+	hfail := ipfs.addFailingEntry("fail1")
+
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h1, hfail}})
+	stats, err := s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Equal(t, 1, stats.Errors)
+	assert.Nil(t, err)
+
+	stats, err = s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Equal(t, 0, stats.Errors)
+	assert.Equal(t, 1, len(stats.PermanentFailures))
+	assert.Equal(t, hfail, stats.PermanentFailures[0].Hash)
+	assert.Equal(t, uint(2), stats.PermanentFailures[0].Failures)
+	assert.Nil(t, err)
+
+	// retried only after the maximum delay, and never carried over
+	stats, err = s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Equal(t, 0, stats.Errors)
+	assert.Equal(t, 0, stats.Deferred)
+	assert.Equal(t, 0, stats.Carried)
+	assert.Equal(t, 1, len(stats.PermanentFailures))
+	assert.Nil(t, err)
+	assert.True(t, ipfs.isPinned(h1))
+}
+
+func TestScopedGC(t *testing.T) {
+	s, ipfs, ens := createMockService(t)
+	h1 := ipfs.addFileEntry("h1")
+	h21 := ipfs.addFileEntry("h21")
+	h22 := ipfs.addFileEntry("h22")
+	h2 := ipfs.addFolderEntry(h21, h22)
+	h3 := ipfs.addFileEntry("h3")
+
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h1}})
+	s.ipfsc.WritePinningManifest("set2.eth", &PinningManifest{Pin: []string{h2}})
+	s.ipfsc.WriteConsortiumManifest("c1.eth", &ConsortiumManifest{
+		Members: []ConsortiumMember{
+			ConsortiumMember{EnsName: "set1.eth"},
+			ConsortiumMember{EnsName: "set2.eth"},
+		},
+	})
+	stats, err := s.Sync(context.Background(), []string{"c1.eth"})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, stats.Errors)
+	assert.Equal(t, 4, stats.Pinned)
+
+	// set2.eth is unreachable, set1.eth changes
+	delete(ens.entries, "set2.eth:"+DefaultManifestKey)
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h3}})
+	stats, err = s.Sync(context.Background(), []string{"c1.eth"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, stats.Errors)
+	assert.Equal(t, 1, stats.Pinned)
+	assert.Equal(t, 1, stats.Unpinned)
+	assert.Equal(t, 1, len(stats.Degraded))
+	assert.Equal(t, DefaultManifestKey+"[set2.eth]", stats.Degraded[0].Source)
+	assert.Equal(t, 3, stats.Degraded[0].Protected)
+	assert.False(t, stats.Degraded[0].Blocking)
+
+	assert.False(t, ipfs.isPinned(h1))
+	assert.True(t, ipfs.isPinned(h2))
+	assert.True(t, ipfs.isPinned(h21))
+	assert.True(t, ipfs.isPinned(h22))
+	assert.True(t, ipfs.isPinned(h3))
+
+	// now the consortium is also unreachable
+	delete(ens.entries, "c1.eth:"+DefaultManifestKey)
+	stats, err = s.Sync(context.Background(), []string{"c1.eth"})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, stats.Unpinned)
+	assert.Equal(t, 2, len(stats.Degraded))
+	assert.Equal(t, DefaultManifestKey+"[set2.eth]", stats.Degraded[0].Source)
+	assert.Equal(t, 3, stats.Degraded[0].Protected)
+	assert.Equal(t, DefaultManifestKey+"[c1.eth]", stats.Degraded[1].Source)
+	assert.Equal(t, 4, stats.Degraded[1].Protected)
+	assert.True(t, ipfs.isPinned(h2))
+	assert.True(t, ipfs.isPinned(h3))
+}
+
+func TestScopedGCRegistry(t *testing.T) {
+	s, ipfs, _, registry := createMockServiceWithRegistry(t)
+	h1 := ipfs.addFileEntry("h1")
+	h2 := ipfs.addFileEntry("h2")
+
+	dao := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	registry.registries[dao] = []string{h1}
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{dao.Hex(), h2}})
+
+	stats, err := s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, stats.Pinned)
+
+	delete(registry.registries, dao)
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{dao.Hex()}})
+	stats, err = s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, stats.Unpinned)
+	assert.Equal(t, []DegradedSource{{Source: dao.Hex(), Error: "Undefined registry", Protected: 1}}, stats.Degraded)
+	assert.True(t, ipfs.isPinned(h1))
+	assert.False(t, ipfs.isPinned(h2))
+}
+
+func TestManifestCache(t *testing.T) {
+	s, ipfs, ens := createMockService(t)
+	ens.block = 100
+	h1 := ipfs.addFileEntry("h1")
+	h2 := ipfs.addFileEntry("h2")
 
 	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h1}})
-	err = s.Sync([]string{"set1.eth"})
-	assert.Equal(t, 0, s.errors)
-	assert.Equal(t, 1, s.pinned)
-	assert.Equal(t, 0, s.unpinned)
+	stats, err := s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, stats.Errors)
+
+	manifesthash := ens.entries["set1.eth:"+DefaultManifestKey]
+	cached, err := s.storage.Manifest("set1.eth")
+	assert.Nil(t, err)
+	assert.Equal(t, manifesthash, cached.Hash)
+	assert.Equal(t, uint64(100), cached.Block)
+
+	// unchanged manifests are read from the cache
+	delete(ipfs.dag, manifesthash)
+	stats, err = s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, stats.Errors)
+	assert.Equal(t, 0, len(stats.Degraded))
+
+	// changed manifests that cannot be downloaded fall back to the cache
+	ens.SetText("set1.eth", DefaultManifestKey, "/ipfs/unavailable")
+	s.ipfsc.WritePinningManifest("set2.eth", &PinningManifest{Pin: []string{h2}})
+	stats, err = s.Sync(context.Background(), []string{"set1.eth", "set2.eth"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, stats.Errors)
+	assert.Equal(t, 1, stats.Pinned)
+	assert.Equal(t, []DegradedSource{{Source: DefaultManifestKey + "[set1.eth]", Error: "Invalid path", Protected: 1}}, stats.Degraded)
+	assert.True(t, ipfs.isPinned(h1))
+}
+
+func TestReappearHash(t *testing.T) {
+	s, ipfs, _ := createMockService(t)
+	h1 := ipfs.addFileEntry("h1")
+
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h1}})
+	stats, err := s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Equal(t, 0, stats.Errors)
+	assert.Equal(t, 1, stats.Pinned)
+	assert.Equal(t, 0, stats.Unpinned)
+	assert.Nil(t, err)
+
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{}})
+	stats, err = s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Equal(t, 0, stats.Errors)
+	assert.Equal(t, 0, stats.Pinned)
+	assert.Equal(t, 1, stats.Unpinned)
+	assert.Nil(t, err)
+
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h1}})
+	stats, err = s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Equal(t, 0, stats.Errors)
+	assert.Equal(t, 1, stats.Pinned)
+	assert.Equal(t, 0, stats.Unpinned)
+	assert.Nil(t, err)
+}
+
+func TestGraceSyncs(t *testing.T) {
+	s, ipfs, _ := createMockService(t)
+	s.GraceSyncs = 2
+	h1 := ipfs.addFileEntry("h1")
+	h2 := ipfs.addFileEntry("h2")
+
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h1, h2}})
+	_, err := s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Nil(t, err)
+
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h2}})
+	for i := 0; i < 2; i++ {
+		stats, err := s.Sync(context.Background(), []string{"set1.eth"})
+		assert.Nil(t, err)
+		assert.Equal(t, 0, stats.Unpinned)
+		assert.Equal(t, 1, stats.Quarantined)
+		assert.True(t, ipfs.isPinned(h1))
+	}
+
+	stats, err := s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, stats.Unpinned)
+	assert.Equal(t, 0, stats.Quarantined)
+	assert.False(t, ipfs.isPinned(h1))
+	assert.True(t, ipfs.isPinned(h2))
+}
+
+func TestGracePeriod(t *testing.T) {
+	s, ipfs, _ := createMockService(t)
+	s.GracePeriod = time.Hour
+	h1 := ipfs.addFileEntry("h1")
+
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h1}})
+	_, err := s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Nil(t, err)
+
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{}})
+	stats, err := s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, stats.Unpinned)
+	assert.Equal(t, 1, stats.Quarantined)
+
+	s.GracePeriod = time.Nanosecond
+	stats, err = s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, stats.Unpinned)
+	assert.False(t, ipfs.isPinned(h1))
+}
+
+func TestGraceEitherLimit(t *testing.T) {
+	s, ipfs, _ := createMockService(t)
+	s.GraceSyncs = 1
+	s.GracePeriod = time.Hour
+	h1 := ipfs.addFileEntry("h1")
+	h2 := ipfs.addFileEntry("h2")
+
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h1, h2}})
+	_, err := s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Nil(t, err)
+
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h2}})
+	stats, err := s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, stats.Unpinned)
+	assert.Equal(t, 1, stats.Quarantined)
+
+	// the syncs limit has passed, but not the period
+	stats, err = s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, stats.Unpinned)
+	assert.False(t, ipfs.isPinned(h1))
+
+	// the period has passed, but not the syncs limit
+	s.GraceSyncs = 10
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{}})
+	stats, err = s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, stats.Quarantined)
+
+	s.GracePeriod = time.Nanosecond
+	stats, err = s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, stats.Unpinned)
+	assert.False(t, ipfs.isPinned(h2))
+}
+
+func TestQuarantinedReappear(t *testing.T) {
+	s, ipfs, _ := createMockService(t)
+	s.GraceSyncs = 1
+	h1 := ipfs.addFileEntry("h1")
+
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h1}})
+	_, err := s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Nil(t, err)
+
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{}})
+	stats, err := s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, stats.Quarantined)
+
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h1}})
+	stats, err = s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, stats.Pinned)
+	assert.Equal(t, 0, stats.Quarantined)
+
+	hentry, err := s.storage.Hash(h1)
+	assert.Nil(t, err)
+	assert.Equal(t, uint(0), hentry.MissedSyncs)
+	assert.Equal(t, uint64(0), hentry.MissedSince)
+
+	// counters were reset, so the grace starts again
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{}})
+	stats, err = s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, stats.Unpinned)
+	assert.Equal(t, 1, stats.Quarantined)
+	assert.True(t, ipfs.isPinned(h1))
+}
+
+func TestCarryUnchanged(t *testing.T) {
+	s, ipfs, _ := createMockService(t)
+	h11 := ipfs.addFileEntry("h11")
+	h12 := ipfs.addFileEntry("h12")
+	h1 := ipfs.addFolderEntry(h11, h12)
+	h2 := ipfs.addFileEntry("h2")
+
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h1}})
+	s.ipfsc.WritePinningManifest("set2.eth", &PinningManifest{Pin: []string{h2}})
+	stats, err := s.Sync(context.Background(), []string{"set1.eth", "set2.eth"})
+	assert.Nil(t, err)
+	assert.Equal(t, 4, stats.Pinned)
+
+	hentry, err := s.storage.Hash(h11)
+	assert.Nil(t, err)
+	epoch := hentry.Epoch
+
+	// unchanged manifests are carried over without updating their hashes
+	stats, err = s.Sync(context.Background(), []string{"set1.eth", "set2.eth"})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, stats.Pinned)
+	assert.Equal(t, 0, stats.Unpinned)
+	assert.Equal(t, 0, stats.Errors)
+	assert.Equal(t, 4, stats.Carried)
+	assert.Equal(t, uint64(8), stats.DataSize)
+
+	hentry, err = s.storage.Hash(h11)
+	assert.Nil(t, err)
+	assert.Equal(t, epoch, hentry.Epoch)
+
+	// a dropped manifest is not carried over when it comes back
+	stats, err = s.Sync(context.Background(), []string{"set2.eth"})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, stats.Unpinned)
+	assert.False(t, ipfs.isPinned(h11))
+
+	stats, err = s.Sync(context.Background(), []string{"set1.eth", "set2.eth"})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, stats.Pinned)
+	assert.True(t, ipfs.isPinned(h1))
+	assert.True(t, ipfs.isPinned(h11))
+	assert.True(t, ipfs.isPinned(h12))
+}
+
+func TestNothingToCollect(t *testing.T) {
+	s, ipfs, _ := createMockService(t)
+	h11 := ipfs.addFileEntry("h11")
+	h12 := ipfs.addFileEntry("h12")
+	h1 := ipfs.addFolderEntry(h11, h12)
+	h2 := ipfs.addFileEntry("h2")
+
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h1}})
+	s.ipfsc.WritePinningManifest("set2.eth", &PinningManifest{Pin: []string{h2}})
+	stats, err := s.Sync(context.Background(), []string{"set1.eth", "set2.eth"})
+	assert.Nil(t, err)
+	assert.Equal(t, 4, stats.Pinned)
+	datasize := stats.DataSize
+
+	// all the pinned hashes are carried over, the hashes are not collected
+	//   nor counted again
+	s.storage.UpdateHash("unknown", &storage.HashEntry{DataSize: 1})
+	stats, err = s.Sync(context.Background(), []string{"set1.eth", "set2.eth"})
+	assert.Nil(t, err)
+	assert.Equal(t, 4, stats.Carried)
+	assert.Equal(t, 0, stats.Unpinned)
+	assert.Equal(t, datasize, stats.DataSize)
+	hentry, err := s.storage.Hash("unknown")
+	assert.Nil(t, err)
+	assert.False(t, hentry.Dirty)
+
+	// a dropped manifest is collected, and the hashes counted again
+	stats, err = s.Sync(context.Background(), []string{"set2.eth"})
+	assert.Nil(t, err)
+	assert.Equal(t, 4, stats.Unpinned)
+	assert.Equal(t, uint64(2), stats.DataSize)
+	assert.False(t, ipfs.isPinned(h1))
+	assert.True(t, ipfs.isPinned(h2))
+
+	stats, err = s.Sync(context.Background(), []string{"set2.eth"})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, stats.Unpinned)
+	assert.Equal(t, uint64(2), stats.DataSize)
+}
+
+func TestCarryUnpinned(t *testing.T) {
+	s, ipfs, _ := createMockService(t)
+	h1 := ipfs.addFileEntry("h1")
+	h2 := ipfs.addFileEntry("h2")
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h1}})
+	s.ipfsc.WritePinningManifest("set2.eth", &PinningManifest{Pin: []string{h2}})
+	s.ipfsc.WriteConsortiumManifest("c.eth", &ConsortiumManifest{
+		Members: []ConsortiumMember{
+			ConsortiumMember{EnsName: "set1.eth"},
+			ConsortiumMember{EnsName: "set2.eth"},
+		},
+	})
+	_, err := s.Sync(context.Background(), []string{"c.eth"})
+	assert.Nil(t, err)
+
+	s.ipfsc.WriteConsortiumManifest("c.eth", &ConsortiumManifest{
+		Members: []ConsortiumMember{
+			ConsortiumMember{EnsName: "set2.eth"},
+		},
+	})
+	_, err = s.SyncNames(context.Background(), []string{"consortiumManifest[c.eth]"})
+	assert.Nil(t, err)
+	stats, err := s.Sync(context.Background(), []string{"c.eth"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, stats.Unpinned)
+	assert.False(t, ipfs.isPinned(h1))
+
+	// the leaf of set1.eth is still in the epoch of the syncs of names, but
+	//   its hash was unpinned
+	s.ipfsc.WriteConsortiumManifest("c.eth", &ConsortiumManifest{
+		Members: []ConsortiumMember{
+			ConsortiumMember{EnsName: "set1.eth"},
+			ConsortiumMember{EnsName: "set2.eth"},
+		},
+	})
+	stats, err = s.SyncNames(context.Background(), []string{"consortiumManifest[c.eth]"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, stats.Pinned)
+	assert.Equal(t, 1, stats.Carried)
+	assert.True(t, ipfs.isPinned(h1))
+
+	stats, err = s.Sync(context.Background(), []string{"c.eth"})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, stats.Pinned)
+	assert.Equal(t, 0, stats.Unpinned)
+	assert.Equal(t, 2, stats.Carried)
+	assert.True(t, ipfs.isPinned(h1))
+}
+
+func TestQuotaSync(t *testing.T) {
+	s, ipfs, _ := createMockService(t)
+	h1 := ipfs.addFileEntry("h1")
+	h2 := ipfs.addFileEntry("h2")
+	h3 := ipfs.addFileEntry("h3")
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h1, h2}})
+	s.ipfsc.WritePinningManifest("set2.eth", &PinningManifest{Pin: []string{h3}})
+
+	s.ipfsc.WriteConsortiumManifest("consortium.eth", &ConsortiumManifest{
+		Members: []ConsortiumMember{
+			ConsortiumMember{EnsName: "set1.eth", Quotum: "3"},
+			ConsortiumMember{EnsName: "set2.eth", Quotum: "1KB"},
+		},
+	})
+
+	stats, err := s.Sync(context.Background(), []string{"consortium.eth"})
+	assert.Equal(t, 2, stats.Pinned)
+	assert.Equal(t, 0, stats.Errors)
+	assert.Equal(t, uint64(4), stats.DataSize)
+	assert.Nil(t, err)
+
+	assert.True(t, ipfs.isPinned(h1))
+	assert.False(t, ipfs.isPinned(h2))
+	assert.True(t, ipfs.isPinned(h3))
+
+	assert.Equal(t, 1, len(stats.QuotaViolations))
+	assert.Equal(t, "set1.eth", stats.QuotaViolations[0].Name)
+	assert.Equal(t, uint64(2), stats.QuotaViolations[0].Used)
+	assert.Equal(t, uint64(1), stats.QuotaViolations[0].Over)
+
+	g, err := s.storage.Globals()
+	assert.Nil(t, err)
+	assert.Equal(t, uint(4), g.CurrentQuota)
+}
+
+func TestMemberAccounting(t *testing.T) {
+	s, ipfs, _ := createMockService(t)
+	h1 := ipfs.addFileEntry("h1")
+	h2 := ipfs.addFileEntry("h22")
+	h3 := ipfs.addFileEntry("h333")
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h1, h2}})
+	s.ipfsc.WritePinningManifest("set2.eth", &PinningManifest{Pin: []string{h2, h3}})
+
+	s.ipfsc.WriteConsortiumManifest("consortium.eth", &ConsortiumManifest{
+		Members: []ConsortiumMember{
+			ConsortiumMember{EnsName: "set1.eth"},
+			ConsortiumMember{EnsName: "set2.eth"},
+		},
+	})
+
+	_, err := s.Sync(context.Background(), []string{"consortium.eth"})
+	assert.Nil(t, err)
+
+	m, err := s.storage.Member("set1.eth")
+	assert.Nil(t, err)
+	assert.Equal(t, uint(2), m.HashCount)
+	assert.Equal(t, uint(5), m.DataSize)
+
+	m, err = s.storage.Member("set2.eth")
+	assert.Nil(t, err)
+	assert.Equal(t, uint(2), m.HashCount)
+	assert.Equal(t, uint(7), m.DataSize)
+
+	s.ipfsc.WriteConsortiumManifest("consortium.eth", &ConsortiumManifest{
+		Members: []ConsortiumMember{
+			ConsortiumMember{EnsName: "set2.eth"},
+		},
+	})
+
+	_, err = s.Sync(context.Background(), []string{"consortium.eth"})
+	assert.Nil(t, err)
+
+	members, err := s.storage.Members()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"set2.eth"}, members)
+}
+
+func TestMemberAccountingWithErrors(t *testing.T) {
+	s, ipfs, _ := createMockService(t)
+	h1 := ipfs.addFileEntry("h1")
+	h2 := ipfs.addFileEntry("h22")
+	h3 := ipfs.addFileEntry("h333")
+	hfail := ipfs.addFailingEntry("fail1")
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h1}})
+	s.ipfsc.WritePinningManifest("set2.eth", &PinningManifest{Pin: []string{h2}})
+	s.ipfsc.WritePinningManifest("set3.eth", &PinningManifest{Pin: []string{h3}})
+
+	s.ipfsc.WriteConsortiumManifest("consortium.eth", &ConsortiumManifest{
+		Members: []ConsortiumMember{
+			ConsortiumMember{EnsName: "set1.eth"},
+			ConsortiumMember{EnsName: "set2.eth"},
+			ConsortiumMember{EnsName: "set3.eth"},
+		},
+	})
+	_, err := s.Sync(context.Background(), []string{"consortium.eth"})
+	assert.Nil(t, err)
+
+	// set2 fails, the other members are still updated, and set3 is not
+	//   removed until a sync without errors
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h1, h3}})
+	s.ipfsc.WritePinningManifest("set2.eth", &PinningManifest{Pin: []string{h2, hfail}})
+	s.ipfsc.WriteConsortiumManifest("consortium.eth", &ConsortiumManifest{
+		Members: []ConsortiumMember{
+			ConsortiumMember{EnsName: "set1.eth"},
+			ConsortiumMember{EnsName: "set2.eth"},
+		},
+	})
+	stats, err := s.Sync(context.Background(), []string{"consortium.eth"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, stats.Errors)
+
+	m, err := s.storage.Member("set1.eth")
+	assert.Nil(t, err)
+	assert.Equal(t, uint(2), m.HashCount)
+	assert.Equal(t, uint(6), m.DataSize)
+
+	m, err = s.storage.Member("set2.eth")
+	assert.Nil(t, err)
+	assert.Equal(t, uint(1), m.HashCount)
+	assert.Equal(t, uint(3), m.DataSize)
+
+	members, err := s.storage.Members()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"set1.eth", "set2.eth", "set3.eth"}, members)
+}
+
+func TestCycleSync(t *testing.T) {
+	s, ipfs, _ := createMockService(t)
+	h1 := ipfs.addFileEntry("h1")
+	h2 := ipfs.addFileEntry("h2")
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h1}})
+	s.ipfsc.WritePinningManifest("set2.eth", &PinningManifest{Pin: []string{h2}})
+
+	s.ipfsc.WriteConsortiumManifest("c1.eth", &ConsortiumManifest{
+		Members: []ConsortiumMember{
+			ConsortiumMember{EnsName: "c1.eth"},
+			ConsortiumMember{EnsName: "c2.eth"},
+			ConsortiumMember{EnsName: "set1.eth"},
+		},
+	})
+	s.ipfsc.WriteConsortiumManifest("c2.eth", &ConsortiumManifest{
+		Members: []ConsortiumMember{
+			ConsortiumMember{EnsName: "c1.eth"},
+			ConsortiumMember{EnsName: "set2.eth"},
+		},
+	})
+
+	stats, err := s.Sync(context.Background(), []string{"c1.eth"})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, stats.Pinned)
+	assert.Equal(t, 0, stats.Errors)
+	assert.Equal(t, []string{"c1.eth>c1.eth", "c1.eth>c2.eth>c1.eth"}, stats.Cycles)
+
+	assert.True(t, ipfs.isPinned(h1))
+	assert.True(t, ipfs.isPinned(h2))
+}
+
+func TestSharedConsortiumReadOnce(t *testing.T) {
+	s, ipfs, ens := createMockService(t)
+	h1 := ipfs.addFileEntry("h1")
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h1}})
+
+	s.ipfsc.WriteConsortiumManifest("shared.eth", &ConsortiumManifest{
+		Members: []ConsortiumMember{
+			ConsortiumMember{EnsName: "set1.eth"},
+		},
+	})
+	s.ipfsc.WriteConsortiumManifest("c1.eth", &ConsortiumManifest{
+		Members: []ConsortiumMember{
+			ConsortiumMember{EnsName: "shared.eth"},
+		},
+	})
+	s.ipfsc.WriteConsortiumManifest("c2.eth", &ConsortiumManifest{
+		Members: []ConsortiumMember{
+			ConsortiumMember{EnsName: "shared.eth"},
+		},
+	})
+
+	stats, err := s.Sync(context.Background(), []string{"c1.eth", "c2.eth"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, stats.Pinned)
+	assert.Equal(t, 0, stats.Errors)
+	assert.Equal(t, 1, ens.reads["shared.eth:"+DefaultManifestKey])
+	assert.Equal(t, 1, ens.reads["set1.eth:"+DefaultManifestKey])
+}
+
+func TestMaxDepthSync(t *testing.T) {
+	s, ipfs, _ := createMockService(t)
+	h1 := ipfs.addFileEntry("h1")
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h1}})
+	s.ipfsc.WriteConsortiumManifest("c2.eth", &ConsortiumManifest{
+		Members: []ConsortiumMember{
+			ConsortiumMember{EnsName: "set1.eth"},
+		},
+	})
+	s.ipfsc.WriteConsortiumManifest("c1.eth", &ConsortiumManifest{
+		Members: []ConsortiumMember{
+			ConsortiumMember{EnsName: "c2.eth"},
+		},
+	})
+
+	s.MaxDepth = 2
+	stats, err := s.Sync(context.Background(), []string{"c1.eth"})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, stats.Pinned)
+	assert.Equal(t, 1, stats.Errors)
+
+	s.MaxDepth = 3
+	stats, err = s.Sync(context.Background(), []string{"c1.eth"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, stats.Pinned)
+	assert.Equal(t, 0, stats.Errors)
+}
+
+func TestContractSync(t *testing.T) {
+	s, ipfs, _, registry := createMockServiceWithRegistry(t)
+	h1 := ipfs.addFileEntry("h1")
+	h2 := ipfs.addFileEntry("h2")
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h2}})
+
+	dao := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	registry.registries[dao] = []string{h1, "set1.eth"}
+
+	s.ipfsc.WriteConsortiumManifest("consortium.eth", &ConsortiumManifest{
+		Members: []ConsortiumMember{
+			ConsortiumMember{EnsName: dao.Hex()},
+		},
+	})
+
+	stats, err := s.Sync(context.Background(), []string{"consortium.eth"})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, stats.Pinned)
+	assert.Equal(t, 0, stats.Errors)
+
+	assert.True(t, ipfs.isPinned(h1))
+	assert.True(t, ipfs.isPinned(h2))
+
+	stats, err = s.Sync(context.Background(), []string{"0x2000000000000000000000000000000000000002"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, stats.Errors)
+}
+
+func TestSyncRoots(t *testing.T) {
+	s, ipfs, _ := createMockService(t)
+	h1 := ipfs.addFileEntry("h1")
+	h2 := ipfs.addFileEntry("h2")
+	h3 := ipfs.addFileEntry("h3")
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h1}})
+	s.ipfsc.WritePinningManifest("set2.eth", &PinningManifest{Pin: []string{h2}})
+	s.ipfsc.WriteConsortiumManifest("consortium.eth", &ConsortiumManifest{
+		Members: []ConsortiumMember{
+			ConsortiumMember{EnsName: "set1.eth"},
+		},
+	})
+
+	_, err := s.Sync(context.Background(), []string{"consortium.eth", "set2.eth"})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]string{
+		"consortiumManifest[consortium.eth]": []string{"consortium.eth"},
+		"consortiumManifest[set1.eth]":       []string{"consortium.eth"},
+		"consortiumManifest[set2.eth]":       []string{"set2.eth"},
+	}, s.Names())
+
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h3}})
+	stats, err := s.SyncRoots(context.Background(), []string{"consortium.eth"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, stats.Pinned)
+	assert.Equal(t, 0, stats.Unpinned)
+
+	assert.True(t, ipfs.isPinned(h1))
+	assert.True(t, ipfs.isPinned(h2))
+	assert.True(t, ipfs.isPinned(h3))
+	assert.Equal(t, 3, len(s.Names()))
+}
+
+func TestSyncNames(t *testing.T) {
+	s, ipfs, ens := createMockService(t)
+	h1 := ipfs.addFileEntry("h1")
+	h2 := ipfs.addFileEntry("h2")
+	h3 := ipfs.addFileEntry("h3")
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h1}})
+	s.ipfsc.WritePinningManifest("set2.eth", &PinningManifest{Pin: []string{h2}})
+	s.ipfsc.WriteConsortiumManifest("consortium.eth", &ConsortiumManifest{
+		Quotum: "4",
+		Members: []ConsortiumMember{
+			ConsortiumMember{EnsName: "set1.eth"},
+			ConsortiumMember{EnsName: "set2.eth"},
+		},
+	})
+
+	_, err := s.Sync(context.Background(), []string{"consortium.eth"})
+	assert.Nil(t, err)
+
+	// only the changed manifest is read again, the consortium quota is
+	//   still enforced
+	s.ipfsc.WritePinningManifest("set2.eth", &PinningManifest{Pin: []string{h2, h3}})
+	reads := ens.reads
+	ens.reads = make(map[string]int)
+	stats, err := s.SyncNames(context.Background(), []string{"consortiumManifest[set2.eth]"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(ens.reads))
+	assert.Equal(t, 1, ens.reads["set2.eth:"+DefaultManifestKey])
+	assert.Equal(t, 0, stats.Pinned)
+	assert.Equal(t, 1, len(stats.QuotaViolations))
+	assert.False(t, ipfs.isPinned(h3))
+	ens.reads = reads
+
+	s.ipfsc.WriteConsortiumManifest("consortium.eth", &ConsortiumManifest{
+		Members: []ConsortiumMember{
+			ConsortiumMember{EnsName: "set1.eth"},
+			ConsortiumMember{EnsName: "set2.eth"},
+		},
+	})
+	stats, err = s.SyncNames(context.Background(), []string{"consortiumManifest[consortium.eth]"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, stats.Pinned)
+	assert.True(t, ipfs.isPinned(h3))
+	assert.Equal(t, 3, len(s.Names()))
+}
+
+func TestPlan(t *testing.T) {
+	s, ipfs, _ := createMockService(t)
+	h1 := ipfs.addFileEntry("h1")
+	h2 := ipfs.addFileEntry("h2")
+	h3 := ipfs.addFileEntry("h3")
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h1}})
+	s.ipfsc.WritePinningManifest("set2.eth", &PinningManifest{Pin: []string{h3}})
+	s.ipfsc.WriteConsortiumManifest("consortium.eth", &ConsortiumManifest{
+		Members: []ConsortiumMember{
+			ConsortiumMember{EnsName: "set1.eth"},
+			ConsortiumMember{EnsName: "set2.eth", Quotum: "1KB"},
+		},
+	})
+	stats, err := s.Sync(context.Background(), []string{"consortium.eth"})
+	assert.Equal(t, 2, stats.Pinned)
+	assert.Nil(t, err)
+
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h2}})
+	s.ipfsc.WriteConsortiumManifest("consortium.eth", &ConsortiumManifest{
+		Members: []ConsortiumMember{
+			ConsortiumMember{EnsName: "set1.eth"},
+			ConsortiumMember{EnsName: "set2.eth", Quotum: "1"},
+		},
+	})
+
+	plan, err := s.Plan(context.Background(), []string{"consortium.eth"})
+	assert.Nil(t, err)
+
+	actions := make(map[string]PlanEntry)
+	for _, entry := range plan.Entries {
+		actions[entry.Hash] = entry
+	}
+	assert.Equal(t, 3, len(actions))
+	assert.Equal(t, PlanPin, actions[h2].Action)
+	assert.Equal(t, uint64(2), actions[h2].Size)
+	assert.Contains(t, actions[h2].Path, "set1.eth")
+	assert.Equal(t, PlanUnpin, actions[h1].Action)
+	assert.Equal(t, PlanUnpin, actions[h3].Action)
+
+	assert.Equal(t, 2, len(plan.Members))
+	assert.Equal(t, "set1.eth", plan.Members[0].Name)
+	assert.Equal(t, uint64(2), plan.Members[0].Used)
+	assert.False(t, plan.Members[0].Exceeded)
+	assert.Equal(t, "set2.eth", plan.Members[1].Name)
+	assert.True(t, plan.Members[1].Exceeded)
+
+	// nothing was pinned, unpinned or stored
+	assert.True(t, ipfs.isPinned(h1))
+	assert.False(t, ipfs.isPinned(h2))
+	assert.True(t, ipfs.isPinned(h3))
+	hentry, err := s.storage.Hash(h2)
+	assert.Nil(t, err)
+	assert.Nil(t, hentry)
+
+	// the names and stats of the service are not changed
+	names := s.Names()
+	current, last := s.Stats()
+	_, err = s.Plan(context.Background(), []string{"set1.eth"})
+	assert.Nil(t, err)
+	assert.Equal(t, names, s.Names())
+	current2, last2 := s.Stats()
+	assert.Equal(t, current, current2)
+	assert.Equal(t, last, last2)
+
+	stats, err = s.Sync(context.Background(), []string{"consortium.eth"})
+	assert.Equal(t, 1, stats.Pinned)
+	assert.Equal(t, 2, stats.Unpinned)
+	assert.Nil(t, err)
+}
+
+func TestWhy(t *testing.T) {
+	s, ipfs, _ := createMockService(t)
+	h11 := ipfs.addFileEntry("h11")
+	h12 := ipfs.addFileEntry("h12")
+	h1 := ipfs.addFolderEntry(h11, h12)
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h1}})
+	s.ipfsc.WritePinningManifest("set2.eth", &PinningManifest{Pin: []string{h11}})
+	s.ipfsc.WriteConsortiumManifest("consortium.eth", &ConsortiumManifest{
+		Members: []ConsortiumMember{
+			ConsortiumMember{EnsName: "set1.eth"},
+			ConsortiumMember{EnsName: "set2.eth"},
+		},
+	})
+
+	stats, err := s.Sync(context.Background(), []string{"consortium.eth"})
+	assert.Equal(t, 3, stats.Pinned)
+	assert.Nil(t, err)
+
+	info, err := s.Why(h11)
+	assert.Nil(t, err)
+	assert.Equal(t, "pinned", info.Status)
+	assert.Equal(t, 2, len(info.Chains))
+	chains := make(map[string]WhyChain)
+	for _, chain := range info.Chains {
+		chains[chain.Member] = chain
+	}
+	assert.Equal(t, "consortium.eth", chains["set1.eth"].Root)
+	assert.Contains(t, chains["set1.eth"].Path, "set1.eth")
+	assert.Equal(t, []string{h1, h11}, chains["set1.eth"].Objects)
+	assert.Equal(t, []string{h11}, chains["set2.eth"].Objects)
+
+	info, err = s.Why("h12")
+	assert.Nil(t, err)
+	assert.Equal(t, h12, info.Hash)
+	assert.Equal(t, 1, len(info.Chains))
+
+	// references no longer seen are removed
+	s.ipfsc.WritePinningManifest("set2.eth", &PinningManifest{Pin: []string{}})
+	stats, err = s.Sync(context.Background(), []string{"consortium.eth"})
+	assert.Equal(t, 3, stats.Carried)
+	assert.Nil(t, err)
+
+	info, err = s.Why(h11)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(info.Chains))
+	assert.Equal(t, "set1.eth", info.Chains[0].Member)
+}
+
+func TestWhyIndexedAgain(t *testing.T) {
+	s, ipfs, _ := createMockService(t)
+	h11 := ipfs.addFileEntry("h11")
+	h12 := ipfs.addFileEntry("h12")
+	h1 := ipfs.addFolderEntry(h11, h12)
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h1}})
+
+	_, err := s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Nil(t, err)
+
+	// references not stored by previous versions are not searched
+	assert.Nil(t, s.storage.DeleteWhy(h11, h1))
+	info, err := s.Why(h11)
+	assert.Nil(t, err)
+	assert.Equal(t, "pinned", info.Status)
+	assert.Equal(t, 0, len(info.Chains))
+
+	// but stored when the object is walked again
+	h2 := ipfs.addFileEntry("h2")
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h1, h2}})
+	_, err = s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Nil(t, err)
+
+	info, err = s.Why(h11)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(info.Chains))
+	assert.Equal(t, []string{h1, h11}, info.Chains[0].Objects)
+}
+
+func TestWhyRecursive(t *testing.T) {
+	s, ipfs, _ := createMockService(t)
+	s.PinMode = PinRecursive
+	h11 := ipfs.addFileEntry("h11")
+	h12 := ipfs.addFileEntry("h12")
+	h1 := ipfs.addFolderEntry(h11, h12)
+	s.ipfsc.WritePinningManifest("set1.eth", &PinningManifest{Pin: []string{h1}})
+
+	_, err := s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Nil(t, err)
+
+	info, err := s.Why(h1)
+	assert.Nil(t, err)
+	assert.Equal(t, "pinned recursively", info.Status)
+	assert.Equal(t, 1, len(info.Chains))
+
+	info, err = s.Why(h11)
+	assert.Nil(t, err)
+	assert.Equal(t, "indirect via "+h1, info.Status)
+	assert.Equal(t, 1, len(info.Chains))
+	assert.Equal(t, "set1.eth", info.Chains[0].Root)
+	assert.Equal(t, []string{h1, h11}, info.Chains[0].Objects)
+
+	// the links pinned directly before are also indirect once unpinned
+	s.PinMode = PinDirect
+	_, err = s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Nil(t, err)
+	s.PinMode = PinRecursive
+	_, err = s.Sync(context.Background(), []string{"set1.eth"})
+	assert.Nil(t, err)
+
+	info, err = s.Why(h12)
 	assert.Nil(t, err)
+	assert.Equal(t, "indirect via "+h1, info.Status)
+	assert.Equal(t, 1, len(info.Chains))
 }
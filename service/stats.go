@@ -4,25 +4,66 @@ import (
 	"fmt"
 
 	"github.com/gin-gonic/gin"
+	eth "github.com/ipfsconsortium/go-ipfsc/eth"
 )
 
 type ServiceStats struct {
-	Count    int `json:"count"`
-	Pinned   int `json:"pinned"`
-	Unpinned int `json:"unpinned"`
-	Errors   int `json:"errors"`
+	Count       int    `json:"count"`
+	Pinned      int    `json:"pinned"`
+	Unpinned    int    `json:"unpinned"`
+	Quarantined int    `json:"quarantined"`
+	Carried     int    `json:"carried"`
+	Deferred    int    `json:"deferred"`
+	Errors      int    `json:"errors"`
+	DataSize    uint64 `json:"datasize"`
+
+	QuotaViolations   []QuotaViolation `json:"quotaviolations"`
+	Cycles            []string         `json:"cycles"`
+	Degraded          []DegradedSource `json:"degraded"`
+	PermanentFailures []FailedHash     `json:"permanentfailures"`
+}
+
+// clone returns a copy of the stats that does not share their slices.
+func (stats ServiceStats) clone() ServiceStats {
+	stats.QuotaViolations = append([]QuotaViolation(nil), stats.QuotaViolations...)
+	stats.Cycles = append([]string(nil), stats.Cycles...)
+	stats.Degraded = append([]DegradedSource(nil), stats.Degraded...)
+	stats.PermanentFailures = append([]FailedHash(nil), stats.PermanentFailures...)
+	return stats
+}
+
+// DegradedSource reports a source that failed to resolve during a sync, and
+// the number of hashes that were kept because they were reached from it.
+// Garbage is not collected if the source is blocking, that is, it was never
+// resolved before.
+type DegradedSource struct {
+	Source    string `json:"source"`
+	Error     string `json:"error"`
+	Protected int    `json:"protected"`
+	Blocking  bool   `json:"blocking"`
 }
 
 type ServerInfo struct {
-	Current ServiceStats `json:"current"`
-	Last    ServiceStats `json:"last"`
+	Current ServiceStats    `json:"current"`
+	Last    ServiceStats    `json:"last"`
+	Scanner *eth.ScanStatus `json:"scanner,omitempty"`
 }
 
 func HttpServe(service *Service, port int) {
 	r := gin.Default()
 
 	r.GET("/stats", func(c *gin.Context) {
-		c.JSON(200, ServerInfo{service.stats, service.laststats})
+		current, last := service.Stats()
+		c.JSON(200, ServerInfo{current, last, service.ScannerStatus()})
+	})
+
+	r.GET("/why", func(c *gin.Context) {
+		info, err := service.Why(c.Query("hash"))
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, info)
 	})
 	r.Run(fmt.Sprintf(":%v", port))
 }
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	eth "github.com/ipfsconsortium/go-ipfsc/eth"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	textChangedEvent = "TextChanged"
+)
+
+// Watcher listens the resolver TextChanged events of the ENS entries reached
+// in the syncs, and notifies the entries that must be synced again.
+type Watcher struct {
+	sync.Mutex
+
+	ens        ENSClient
+	dispatcher *eth.ScanEventDispatcher
+	resolver   abi.ABI
+
+	resolvers map[common.Address]bool
+	entries   map[common.Hash]map[common.Hash]string
+
+	// changed entries not yet taken, and the signal that there are some,
+	//   sent without blocking the dispatcher
+	pending map[string]bool
+	changed chan struct{}
+}
+
+func NewWatcher(ens ENSClient, dispatcher *eth.ScanEventDispatcher) (*Watcher, error) {
+
+	resolverabi, err := abi.JSON(bytes.NewReader([]byte(ensResolverAbi)))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Watcher{
+		ens:        ens,
+		dispatcher: dispatcher,
+		resolver:   resolverabi,
+		resolvers:  make(map[common.Address]bool),
+		entries:    make(map[common.Hash]map[common.Hash]string),
+		pending:    make(map[string]bool),
+		changed:    make(chan struct{}, 1),
+	}, nil
+}
+
+// Update the watched ENS entries, see Service.Names. Handlers are registered
+// for the resolvers that were not already watched, and unregistered for the
+// resolvers no longer used.
+func (w *Watcher) Update(names map[string][]string) error {
+
+	entries := make(map[common.Hash]map[common.Hash]string)
+	resolvers := make(map[common.Address]bool)
+
+	for entry := range names {
+		ensname, key, err := parseENSEntry(entry)
+		if err != nil {
+			return err
+		}
+		resolver, err := w.ens.Resolver(context.Background(), ensname)
+		if err != nil {
+			return err
+		}
+		resolvers[resolver] = true
+
+		node := NameHash(ensname)
+		if _, ok := entries[node]; !ok {
+			entries[node] = make(map[common.Hash]string)
+		}
+		entries[node][crypto.Keccak256Hash([]byte(key))] = entry
+	}
+
+	w.Lock()
+	defer w.Unlock()
+
+	for resolver := range resolvers {
+		if w.resolvers[resolver] {
+			continue
+		}
+		log.WithField("resolver", resolver.Hex()).Info("Watching ENS resolver")
+		w.dispatcher.RegisterHandler(resolver, &w.resolver, textChangedEvent, w.handleTextChanged, nil)
+		w.resolvers[resolver] = true
+	}
+	for resolver := range w.resolvers {
+		if resolvers[resolver] {
+			continue
+		}
+		log.WithField("resolver", resolver.Hex()).Info("Not watching ENS resolver")
+		w.dispatcher.UnregisterHandler(resolver, textChangedEvent)
+		delete(w.resolvers, resolver)
+	}
+	w.entries = entries
+
+	return nil
+}
+
+// Changed returns the channel that receives when there are changed entries,
+// see Pending.
+func (w *Watcher) Changed() <-chan struct{} {
+	return w.changed
+}
+
+// Pending returns the entries changed since the last call, each one once.
+func (w *Watcher) Pending() []string {
+	w.Lock()
+	defer w.Unlock()
+
+	entries := make([]string, 0, len(w.pending))
+	for entry := range w.pending {
+		entries = append(entries, entry)
+	}
+	sort.Strings(entries)
+	w.pending = make(map[string]bool)
+	return entries
+}
+
+func (w *Watcher) handleTextChanged(logevent *types.Log, handler *eth.ScanEventHandler) error {
+
+	// TextChanged(bytes32 indexed node, string indexed indexedKey, string key)
+	if len(logevent.Topics) < 3 {
+		return nil
+	}
+	node, keyhash := logevent.Topics[1], logevent.Topics[2]
+
+	w.Lock()
+	entry, ok := w.entries[node][keyhash]
+	if ok {
+		w.pending[entry] = true
+	}
+	w.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	// a reverted change is synced again, since ENS returns the text of the
+	//   canonical chain
+	msg := "ENS text changed"
+	if logevent.Removed {
+		msg = "ENS text change reverted"
+	}
+	log.WithFields(log.Fields{
+		"entry": entry,
+		"tx":    logevent.TxHash.Hex(),
+	}).Info(msg)
+
+	// the entries are taken when the loop is not syncing, meanwhile the
+	//   changes are coalesced
+	select {
+	case w.changed <- struct{}{}:
+	default:
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	eth "github.com/ipfsconsortium/go-ipfsc/eth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatcherTextChanged(t *testing.T) {
+	dispatcher := eth.NewScanEventDispatcher(nil, eth.NewMemorySavePoint(0))
+	w, err := NewWatcher(NewENSMock(), dispatcher)
+	assert.Nil(t, err)
+
+	err = w.Update(map[string][]string{
+		"consortiumManifest[set1.eth]": []string{"consortium.eth"},
+	})
+	assert.Nil(t, err)
+
+	textChanged := func(name, key string) *types.Log {
+		return &types.Log{
+			Topics: []common.Hash{
+				w.resolver.Events[textChangedEvent].Id(),
+				NameHash(name),
+				crypto.Keccak256Hash([]byte(key)),
+			},
+		}
+	}
+
+	assert.Nil(t, w.handleTextChanged(textChanged("set2.eth", DefaultManifestKey), nil))
+	assert.Nil(t, w.handleTextChanged(textChanged("set1.eth", "url"), nil))
+	assert.Equal(t, 0, len(w.Changed()))
+
+	assert.Nil(t, w.handleTextChanged(textChanged("set1.eth", DefaultManifestKey), nil))
+	<-w.Changed()
+	assert.Equal(t, []string{"consortiumManifest[set1.eth]"}, w.Pending())
+	assert.Equal(t, 0, len(w.Pending()))
+
+	// resolvers no longer reached are not watched
+	assert.Nil(t, w.Update(map[string][]string{}))
+	assert.Equal(t, 0, len(w.resolvers))
+}
+
+func TestWatcherCoalesce(t *testing.T) {
+	dispatcher := eth.NewScanEventDispatcher(nil, eth.NewMemorySavePoint(0))
+	w, err := NewWatcher(NewENSMock(), dispatcher)
+	assert.Nil(t, err)
+
+	err = w.Update(map[string][]string{
+		"consortiumManifest[set1.eth]": []string{"consortium.eth"},
+		"consortiumManifest[set2.eth]": []string{"consortium.eth"},
+	})
+	assert.Nil(t, err)
+
+	textChanged := func(name string) *types.Log {
+		return &types.Log{
+			Topics: []common.Hash{
+				w.resolver.Events[textChangedEvent].Id(),
+				NameHash(name),
+				crypto.Keccak256Hash([]byte(DefaultManifestKey)),
+			},
+		}
+	}
+
+	// the dispatcher handles many events while the loop is syncing, and
+	//   then it is stopped without the loop receiving them
+	stopped := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			w.handleTextChanged(textChanged("set1.eth"), nil)
+			w.handleTextChanged(textChanged("set2.eth"), nil)
+		}
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler blocked")
+	}
+
+	assert.Equal(t, 1, len(w.Changed()))
+	<-w.Changed()
+	assert.Equal(t, []string{
+		"consortiumManifest[set1.eth]",
+		"consortiumManifest[set2.eth]",
+	}, w.Pending())
+}
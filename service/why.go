@@ -0,0 +1,143 @@
+package service
+
+import (
+	"strings"
+
+	sto "github.com/ipfsconsortium/go-ipfsc/storage"
+)
+
+const (
+	// maxWhyChains is the maximum number of chains returned by Why
+	maxWhyChains = 100
+)
+
+// WhyChain is a chain of references that reaches an IPFS hash: the root and
+// the consortium member where it starts, the ENS path of the manifest that
+// pins a hash, the last epoch it was seen, and the objects linked from that
+// hash down to the IPFS hash.
+type WhyChain struct {
+	Root    string   `json:"root"`
+	Member  string   `json:"member"`
+	Path    string   `json:"path"`
+	Epoch   uint64   `json:"epoch"`
+	Objects []string `json:"objects"`
+}
+
+// WhyInfo is the pin status of an IPFS hash and the chains that reach it.
+type WhyInfo struct {
+	Hash      string     `json:"hash"`
+	Status    string     `json:"status"`
+	Chains    []WhyChain `json:"chains"`
+	Truncated bool       `json:"truncated"`
+}
+
+// Why returns why an IPFS hash is pinned, from the references stored by the
+// syncs.
+func (s *Service) Why(hash string) (*WhyInfo, error) {
+	return Why(s.storage, hash)
+}
+
+// Why returns why an IPFS hash is pinned, from the references stored by the
+// syncs. The references from the objects pinned by previous versions are
+// stored when a sync walks them again. The objects of a recursive pin are
+// reported as indirect if the pin links them, the deeper ones are unknown.
+func Why(storage *sto.Storage, hash string) (*WhyInfo, error) {
+
+	if !strings.HasPrefix(hash, "/ipfs/") {
+		hash = "/ipfs/" + hash
+	}
+	hentry, err := storage.Hash(hash)
+	if err != nil {
+		return nil, err
+	}
+	info := &WhyInfo{Hash: hash, Status: whyStatus(hentry)}
+
+	// walk up the references, with the objects from the hash up to each one
+	type step struct {
+		hash    string
+		objects []string
+	}
+	for stack := []step{{hash, []string{hash}}}; len(stack) > 0 && !info.Truncated; {
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		wentries, err := storage.Why(current.hash)
+		if err != nil {
+			return nil, err
+		}
+		for _, wentry := range wentries {
+			if wentry.Parent == "" {
+				if len(info.Chains) == maxWhyChains {
+					info.Truncated = true
+					break
+				}
+				objects := make([]string, len(current.objects))
+				for i, object := range current.objects {
+					objects[len(objects)-1-i] = object
+				}
+				info.Chains = append(info.Chains, WhyChain{
+					Root:    wentry.Root,
+					Member:  wentry.Member,
+					Path:    wentry.Path,
+					Epoch:   wentry.Epoch,
+					Objects: objects,
+				})
+				continue
+			}
+			if contains(current.objects, wentry.Parent) {
+				continue
+			}
+			if ok, err := linksTo(storage, wentry.Parent, current.hash); err != nil {
+				return nil, err
+			} else if !ok {
+				continue
+			}
+			objects := append(append([]string{}, current.objects...), wentry.Parent)
+			stack = append(stack, step{wentry.Parent, objects})
+		}
+	}
+
+	// the links of recursive pins are not stored as pinned
+	if hentry == nil || hentry.Dirty {
+		for _, chain := range info.Chains {
+			if len(chain.Objects) > 1 {
+				info.Status = "indirect via " + chain.Objects[0]
+				break
+			}
+		}
+	}
+	return info, nil
+}
+
+// whyStatus returns the pin status of a hash entry.
+func whyStatus(hentry *sto.HashEntry) string {
+	switch {
+	case hentry == nil:
+		return "unknown"
+	case hentry.Dirty:
+		return "unpinned"
+	case hentry.MissedSyncs > 0:
+		return "pending removal"
+	case hentry.Recursive:
+		return "pinned recursively"
+	}
+	return "pinned"
+}
+
+// linksTo returns if the pinned object parent links hash.
+func linksTo(storage *sto.Storage, parent, hash string) (bool, error) {
+	hentry, err := storage.Hash(parent)
+	if err != nil || hentry == nil || hentry.Dirty {
+		return false, err
+	}
+	return contains(hentry.Links, hash), nil
+}
+
+func contains(list []string, item string) bool {
+	for _, element := range list {
+		if element == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// DryRun returns a storage that reads the current state, and whose writes are
+// discarded by Discard. The dry run holds the write lock of the db until
+// then, so every other write to the storage, e.g. of a sync running in
+// event mode, blocks for the whole dry run.
+func (s *Storage) DryRun() (*Storage, error) {
+
+	db, ok := s.db.(*leveldb.DB)
+	if !ok {
+		return nil, errors.New("storage is already a dry run")
+	}
+	tr, err := db.OpenTransaction()
+	if err != nil {
+		return nil, err
+	}
+	return &Storage{
+		db:    tr,
+		mutex: &sync.Mutex{},
+	}, nil
+}
+
+// Discard discards the writes of a dry run storage.
+func (s *Storage) Discard() {
+	if tr, ok := s.db.(*leveldb.Transaction); ok {
+		tr.Discard()
+	}
+}
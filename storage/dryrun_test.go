@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDryRun(t *testing.T) {
+	s := CreateTestDB(t)
+	assert.Nil(t, s.AddHash("h1", &HashEntry{DataSize: 1}))
+
+	dry, err := s.DryRun()
+	assert.Nil(t, err)
+	assert.Nil(t, dry.UpdateHash("h1", &HashEntry{DataSize: 2}))
+	assert.Nil(t, dry.AddHash("h2", &HashEntry{DataSize: 3}))
+
+	h, err := dry.Hash("h1")
+	assert.Nil(t, err)
+	assert.Equal(t, uint(2), h.DataSize)
+	h, err = dry.Hash("h2")
+	assert.Nil(t, err)
+	assert.Equal(t, uint(3), h.DataSize)
+
+	dry.Discard()
+
+	h, err = s.Hash("h1")
+	assert.Nil(t, err)
+	assert.Equal(t, uint(1), h.DataSize)
+	h, err = s.Hash("h2")
+	assert.Nil(t, err)
+	assert.Nil(t, h)
+}
@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"time"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/rlp"
 )
 
@@ -26,17 +28,27 @@ func (s *Storage) Dump(w io.Writer) {
 		case isPrefix(key, prefixHash):
 
 			w.Write([]byte(fmt.Sprintf("HASH %v", string(key[len(prefixHash):]))))
-			var entry HashEntry
-			err := rlp.DecodeBytes(value, &entry)
+			entry, err := decodeHashEntry(value)
 			if err != nil {
-				w.Write([]byte("| *READ ERROR"))
+				w.Write([]byte("| *READ ERROR\n"))
 				break
 			}
+			w.Write([]byte(fmt.Sprintf("| size=%v", entry.DataSize)))
 			w.Write([]byte(fmt.Sprintf("| dirty=%v", entry.Dirty)))
-			w.Write([]byte(fmt.Sprintf("| mark=%v", entry.Mark)))
+			w.Write([]byte(fmt.Sprintf("| epoch=%v", entry.Epoch)))
+			if entry.Recursive {
+				w.Write([]byte("| recursive"))
+			}
+			if entry.MissedSyncs > 0 {
+				w.Write([]byte(fmt.Sprintf(
+					"| pending-removal(missed=%v since=%v)",
+					entry.MissedSyncs, time.Unix(int64(entry.MissedSince), 0).UTC().Format(time.RFC3339),
+				)))
+			}
 			for _, h := range entry.Links {
 				w.Write([]byte(fmt.Sprintf("| %v", h)))
 			}
+			w.Write([]byte("\n"))
 
 		case isPrefix(key, prefixMember):
 
@@ -51,21 +63,137 @@ func (s *Storage) Dump(w io.Writer) {
 				break
 			}
 
-			w.Write([]byte(fmt.Sprintf("\n| hashcount=%v\n", entry.HashCount)))
+			w.Write([]byte(fmt.Sprintf("\n| hashcount=%v", entry.HashCount)))
+			w.Write([]byte(fmt.Sprintf("\n| datasize=%v\n", entry.DataSize)))
+
+		case isPrefix(key, prefixResolves):
+
+			w.Write([]byte(fmt.Sprintf("RESOLVES %v", string(key[len(prefixResolves):]))))
+
+			var entry ResolvesEntry
+			err := rlp.DecodeBytes(value, &entry)
+			if err != nil {
+				w.Write([]byte("| *READ ERROR\n"))
+				break
+			}
+			for _, h := range entry.Entries {
+				w.Write([]byte(fmt.Sprintf("| %v", h)))
+			}
+			w.Write([]byte("\n"))
+
+		case isPrefix(key, prefixManifest):
+
+			w.Write([]byte(fmt.Sprintf("MANIFEST %v", string(key[len(prefixManifest):]))))
+
+			var entry ManifestEntry
+			err := rlp.DecodeBytes(value, &entry)
+			if err != nil {
+				w.Write([]byte("| *READ ERROR\n"))
+				break
+			}
+			w.Write([]byte(fmt.Sprintf(
+				"| hash=%v| block=%v| seen=%v\n",
+				entry.Hash, entry.Block, time.Unix(int64(entry.Seen), 0).UTC().Format(time.RFC3339),
+			)))
+
+		case isPrefix(key, prefixLeaf):
+
+			w.Write([]byte(fmt.Sprintf("LEAF %v", string(key[len(prefixLeaf):]))))
+
+			var entry LeafEntry
+			err := rlp.DecodeBytes(value, &entry)
+			if err != nil {
+				w.Write([]byte("| *READ ERROR\n"))
+				break
+			}
+			w.Write([]byte(fmt.Sprintf(
+				"| manifest=%v| epoch=%v| hashes=%v\n",
+				entry.Manifest, entry.Epoch, len(entry.Hashes),
+			)))
+
+		case isPrefix(key, prefixQueue):
+
+			var entry QueueEntry
+			err := rlp.DecodeBytes(value, &entry)
+			if err != nil {
+				w.Write([]byte("QUEUE | *READ ERROR\n"))
+				break
+			}
+			w.Write([]byte(fmt.Sprintf("QUEUE %v| member=%v| parent=%v\n", entry.Hash, queueMember(key), entry.Parent)))
+
+		case isPrefix(key, prefixFailure):
+
+			var entry FailureEntry
+			err := rlp.DecodeBytes(value, &entry)
+			if err != nil {
+				w.Write([]byte("FAILURE | *READ ERROR\n"))
+				break
+			}
+			w.Write([]byte(fmt.Sprintf("FAILURE %v| failures=%v permanent=%v next=%v error=%v\n",
+				string(key[len(prefixFailure):]), entry.Failures, entry.Permanent,
+				time.Unix(int64(entry.NextRetry), 0).UTC().Format(time.RFC3339), entry.LastError)))
+
+		case isPrefix(key, prefixWhy):
+
+			var entry WhyEntry
+			err := rlp.DecodeBytes(value, &entry)
+			if err != nil {
+				w.Write([]byte("WHY | *READ ERROR\n"))
+				break
+			}
+			hash := bytes.SplitN(key[len(prefixWhy):], []byte{0}, 2)[0]
+			if entry.Parent != "" {
+				w.Write([]byte(fmt.Sprintf("WHY %v| parent=%v\n", string(hash), entry.Parent)))
+			} else {
+				w.Write([]byte(fmt.Sprintf("WHY %v| root=%v member=%v path=%v epoch=%v\n",
+					string(hash), entry.Root, entry.Member, entry.Path, entry.Epoch)))
+			}
+
+		case isPrefix(key, prefixSavePoint):
+
+			w.Write([]byte("SAVEPOINT "))
+
+			var entry SavePointEntry
+			err := rlp.DecodeBytes(value, &entry)
+			if err != nil {
+				w.Write([]byte("| *READ ERROR"))
+				break
+			}
+			w.Write([]byte(fmt.Sprintf(
+				"\n| LastBlock=%v\n| LastTxIndex=%v\n| LastLogIndex=%v\n",
+				entry.LastBlock, entry.LastTxIndex, entry.LastLogIndex,
+			)))
+
+		case isPrefix(key, prefixHistory):
+
+			var entries []ProcessedBlockEntry
+			err := rlp.DecodeBytes(value, &entries)
+			if err != nil {
+				w.Write([]byte("HISTORY | *READ ERROR\n"))
+				break
+			}
+			for _, entry := range entries {
+				w.Write([]byte(fmt.Sprintf("HISTORY %v| hash=%v logs=%v\n",
+					entry.Number, entry.Hash.Hex(), len(entry.Logs))))
+			}
+
+		case isPrefix(key, prefixSkipTx):
+
+			txid := common.BytesToHash(key[len(prefixSkipTx):])
+			w.Write([]byte(fmt.Sprintf("SKIPTX %v\n", txid.Hex())))
 
 		case isPrefix(key, prefixGlobals):
 
 			w.Write([]byte("GLOBALS "))
 
-			var entry GlobalsEntry
-			err := rlp.DecodeBytes(value, &entry)
+			entry, err := s.Globals()
 			if err != nil {
 				w.Write([]byte("| *READ ERROR"))
 				break
 			}
 			w.Write([]byte(fmt.Sprintf(
-				"\n| CurrentQuota=%v\n",
-				entry.CurrentQuota,
+				"\n| CurrentQuota=%v\n| Epoch=%v\n",
+				entry.CurrentQuota, entry.Epoch,
 			)))
 
 		}
@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"github.com/ethereum/go-ethereum/rlp"
+	dberr "github.com/syndtr/goleveldb/leveldb/errors"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Failure returns the failures of an IPFS hash, or nil if it did not fail
+// since it was last pinned.
+func (s *Storage) Failure(hash string) (*FailureEntry, error) {
+
+	fkey := append([]byte(prefixFailure), []byte(hash)...)
+	fvalue, err := s.db.Get(fkey, nil)
+	if err == dberr.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var fentry FailureEntry
+	if err = rlp.DecodeBytes(fvalue, &fentry); err != nil {
+		return nil, err
+	}
+	return &fentry, nil
+}
+
+// SetFailure sets the failures of an IPFS hash.
+func (s *Storage) SetFailure(hash string, fentry *FailureEntry) error {
+
+	fkey := append([]byte(prefixFailure), []byte(hash)...)
+	fvalue, err := rlp.EncodeToBytes(fentry)
+	if err != nil {
+		return err
+	}
+	return s.db.Put(fkey, fvalue, nil)
+}
+
+// DeleteFailure removes the failures of an IPFS hash.
+func (s *Storage) DeleteFailure(hash string) error {
+
+	fkey := append([]byte(prefixFailure), []byte(hash)...)
+	return s.db.Delete(fkey, nil)
+}
+
+// PurgeFailures removes the failures of the IPFS hashes not reached since
+// epoch.
+func (s *Storage) PurgeFailures(epoch uint64) error {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	iter := s.db.NewIterator(util.BytesPrefix([]byte(prefixFailure)), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		var fentry FailureEntry
+		if err := rlp.DecodeBytes(iter.Value(), &fentry); err != nil {
+			return err
+		}
+		if fentry.Epoch < epoch {
+			if err := s.db.Delete(iter.Key(), nil); err != nil {
+				return err
+			}
+		}
+	}
+	return iter.Error()
+}
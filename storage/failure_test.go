@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFailure(t *testing.T) {
+	s := CreateTestDB(t)
+
+	f, err := s.Failure("h1")
+	assert.Nil(t, err)
+	assert.Nil(t, f)
+
+	assert.Nil(t, s.SetFailure("h1", &FailureEntry{
+		Failures:  2,
+		LastError: "timeout",
+		NextRetry: 1000,
+		Epoch:     3,
+	}))
+	assert.Nil(t, s.SetFailure("h2", &FailureEntry{Failures: 1, Epoch: 2}))
+
+	f, err = s.Failure("h1")
+	assert.Nil(t, err)
+	assert.Equal(t, uint(2), f.Failures)
+	assert.Equal(t, "timeout", f.LastError)
+	assert.Equal(t, uint64(1000), f.NextRetry)
+	assert.Equal(t, false, f.Permanent)
+
+	assert.Nil(t, s.PurgeFailures(3))
+	f, err = s.Failure("h2")
+	assert.Nil(t, err)
+	assert.Nil(t, f)
+
+	assert.Nil(t, s.DeleteFailure("h1"))
+	f, err = s.Failure("h1")
+	assert.Nil(t, err)
+	assert.Nil(t, f)
+}
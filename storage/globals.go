@@ -12,11 +12,15 @@ func (s *Storage) Globals() (*GlobalsEntry, error) {
 	value, err := s.db.Get(key, nil)
 
 	var entry GlobalsEntry
-	err = rlp.DecodeBytes(value, &entry)
-	if err != nil {
+	if err = rlp.DecodeBytes(value, &entry); err == nil {
+		return &entry, nil
+	}
+
+	var legacy legacyGlobalsEntry
+	if rlp.DecodeBytes(value, &legacy) != nil {
 		return nil, err
 	}
-	return &entry, nil
+	return &GlobalsEntry{CurrentQuota: legacy.CurrentQuota}, nil
 }
 
 // SetGlobals in the storage.
@@ -3,6 +3,8 @@ package storage
 import (
 	"testing"
 
+	"github.com/ethereum/go-ethereum/rlp"
+
 	"github.com/stretchr/testify/assert"
 )
 
@@ -18,3 +20,18 @@ func TestSetGlobals(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, uint(1313), g.CurrentQuota)
 }
+
+func TestLegacyGlobals(t *testing.T) {
+	s := CreateTestDB(t)
+
+	gvalue, err := rlp.EncodeToBytes(&legacyGlobalsEntry{
+		CurrentQuota: 1313,
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, s.db.Put([]byte(prefixGlobals), gvalue, nil))
+
+	g, err := s.Globals()
+	assert.Nil(t, err)
+	assert.Equal(t, uint(1313), g.CurrentQuota)
+	assert.Equal(t, uint64(0), g.Epoch)
+}
@@ -6,8 +6,31 @@ import (
 	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
+// decodeHashEntry decodes a hash entry, also if stored by previous versions.
+func decodeHashEntry(value []byte) (*HashEntry, error) {
+
+	var hentry HashEntry
+	err := rlp.DecodeBytes(value, &hentry)
+	if err == nil {
+		return &hentry, nil
+	}
+
+	var legacy legacyHashEntry
+	if rlp.DecodeBytes(value, &legacy) != nil {
+		return nil, err
+	}
+	return &HashEntry{
+		DataSize: legacy.DataSize,
+		Links:    legacy.Links,
+		Dirty:    legacy.Dirty,
+	}, nil
+}
+
 func (s *Storage) AddHash(hash string, hentry *HashEntry) error {
 
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
 	hkey := append([]byte(prefixHash), []byte(hash)...)
 	hvalue, err := s.db.Get(hkey, nil)
 	if err != dberr.ErrNotFound {
@@ -46,8 +69,13 @@ func (s *Storage) UpdateHash(hash string, hentry *HashEntry) error {
 
 type UpdateFunc func(hash string, entry *HashEntry) *HashEntry
 
+// HashUpdateIter calls uf for each hash entry, and stores the entry returned
+// if not nil. The storage is locked meanwhile, so uf cannot add hashes or
+// use the traversal queues.
 func (s *Storage) HashUpdateIter(uf UpdateFunc) error {
-	var err error
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 
 	iter := s.db.NewIterator(util.BytesPrefix([]byte(prefixHash)), nil)
 	defer iter.Release()
@@ -55,12 +83,12 @@ func (s *Storage) HashUpdateIter(uf UpdateFunc) error {
 	for iter.Next() {
 		hkey := iter.Key()
 		hash := string(hkey[len(prefixHash):])
-		var hentry HashEntry
-		if err = rlp.DecodeBytes(iter.Value(), &hentry); err != nil {
+		hentry, err := decodeHashEntry(iter.Value())
+		if err != nil {
 			return err
 		}
 
-		if updated := uf(hash, &hentry); updated != nil {
+		if updated := uf(hash, hentry); updated != nil {
 			var hvalue []byte
 			if hvalue, err = rlp.EncodeToBytes(updated); err != nil {
 				return err
@@ -81,8 +109,6 @@ func (s *Storage) Hash(hash string) (*HashEntry, error) {
 	} else if err != nil {
 		return nil, err
 	}
-	var hentry HashEntry
-	err = rlp.DecodeBytes(hvalue, &hentry)
-	return &hentry, err
+	return decodeHashEntry(hvalue)
 
 }
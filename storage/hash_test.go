@@ -3,6 +3,8 @@ package storage
 import (
 	"testing"
 
+	"github.com/ethereum/go-ethereum/rlp"
+
 	"github.com/stretchr/testify/assert"
 )
 
@@ -12,7 +14,7 @@ func TestAddHash(t *testing.T) {
 	err := s.AddHash("h1", &HashEntry{
 		DataSize: 1000,
 		Links:    []string{"1", "2"},
-		Mark:     true,
+		Epoch:    2,
 		Dirty:    false,
 	})
 	assert.Nil(t, err)
@@ -23,7 +25,7 @@ func TestAddHash(t *testing.T) {
 	assert.Equal(t, 2, len(h.Links))
 	assert.Equal(t, "1", h.Links[0])
 	assert.Equal(t, "2", h.Links[1])
-	assert.Equal(t, true, h.Mark)
+	assert.Equal(t, uint64(2), h.Epoch)
 	assert.Equal(t, false, h.Dirty)
 }
 
@@ -41,7 +43,7 @@ func TestDeleteHash(t *testing.T) {
 	err := s.AddHash("h1", &HashEntry{
 		DataSize: 1000,
 		Links:    []string{"1", "2"},
-		Mark:     true,
+		Epoch:    2,
 		Dirty:    false,
 	})
 	assert.Nil(t, err)
@@ -59,14 +61,14 @@ func TestUpdateHash(t *testing.T) {
 	err := s.AddHash("h1", &HashEntry{
 		DataSize: 1000,
 		Links:    []string{"1", "2"},
-		Mark:     true,
+		Epoch:    2,
 		Dirty:    false,
 	})
 	assert.Nil(t, err)
 	err = s.UpdateHash("h1", &HashEntry{
 		DataSize: 1001,
 		Links:    []string{"3"},
-		Mark:     false,
+		Epoch:    0,
 		Dirty:    true,
 	})
 	assert.Nil(t, err)
@@ -76,7 +78,7 @@ func TestUpdateHash(t *testing.T) {
 	assert.Equal(t, uint(1001), h.DataSize)
 	assert.Equal(t, 1, len(h.Links))
 	assert.Equal(t, "3", h.Links[0])
-	assert.Equal(t, false, h.Mark)
+	assert.Equal(t, uint64(0), h.Epoch)
 	assert.Equal(t, true, h.Dirty)
 }
 
@@ -85,19 +87,19 @@ func TestUpdateHashIter(t *testing.T) {
 
 	assert.Nil(t, s.AddHash("h1", &HashEntry{
 		DataSize: 1000, Links: []string{"1", "2"},
-		Mark: true, Dirty: false,
+		Epoch: 2, Dirty: false,
 	}))
 	assert.Nil(t, s.AddHash("h2", &HashEntry{
 		DataSize: 1001, Links: []string{"1", "2"},
-		Mark: false, Dirty: false,
+		Epoch: 0, Dirty: false,
 	}))
 	assert.Nil(t, s.AddHash("h3", &HashEntry{
 		DataSize: 1002, Links: []string{"1", "2"},
-		Mark: true, Dirty: false,
+		Epoch: 2, Dirty: false,
 	}))
 
 	s.HashUpdateIter(func(hash string, entry *HashEntry) *HashEntry {
-		if !entry.Mark {
+		if entry.Epoch == 0 {
 			entry.Dirty = true
 			return entry
 		}
@@ -116,3 +118,23 @@ func TestUpdateHashIter(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, false, h.Dirty)
 }
+
+func TestLegacyHash(t *testing.T) {
+	s := CreateTestDB(t)
+
+	hvalue, err := rlp.EncodeToBytes(&legacyHashEntry{
+		DataSize: 1000,
+		Links:    []string{"1"},
+		Mark:     false,
+		Dirty:    true,
+	})
+	assert.Nil(t, err)
+	err = s.db.Put(append([]byte(prefixHash), []byte("h1")...), hvalue, nil)
+	assert.Nil(t, err)
+
+	h, err := s.Hash("h1")
+	assert.Nil(t, err)
+	assert.Equal(t, uint(1000), h.DataSize)
+	assert.Equal(t, true, h.Dirty)
+	assert.Equal(t, uint(0), h.MissedSyncs)
+}
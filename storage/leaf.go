@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"github.com/ethereum/go-ethereum/rlp"
+	dberr "github.com/syndtr/goleveldb/leveldb/errors"
+)
+
+// Leaf returns the hashes reached from the pinning manifest of an ENS name,
+// or nil if it was never completely collected.
+func (s *Storage) Leaf(ensname string) (*LeafEntry, error) {
+
+	lkey := append([]byte(prefixLeaf), []byte(ensname)...)
+	lvalue, err := s.db.Get(lkey, nil)
+	if err == dberr.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var lentry LeafEntry
+	if err = rlp.DecodeBytes(lvalue, &lentry); err != nil {
+		return nil, err
+	}
+	return &lentry, nil
+}
+
+// SetLeaf sets the hashes reached from the pinning manifest of an ENS name.
+func (s *Storage) SetLeaf(ensname string, lentry *LeafEntry) error {
+
+	lkey := append([]byte(prefixLeaf), []byte(ensname)...)
+	lvalue, err := rlp.EncodeToBytes(lentry)
+	if err != nil {
+		return err
+	}
+	return s.db.Put(lkey, lvalue, nil)
+}
@@ -0,0 +1,30 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLeaf(t *testing.T) {
+	s := CreateTestDB(t)
+
+	l, err := s.Leaf("a.eth")
+	assert.Nil(t, err)
+	assert.Nil(t, l)
+
+	err = s.SetLeaf("a.eth", &LeafEntry{
+		Manifest: "/ipfs/m1",
+		Epoch:    3,
+		Hashes:   []string{"h1", "h2"},
+		Sizes:    []uint64{10, 20},
+	})
+	assert.Nil(t, err)
+
+	l, err = s.Leaf("a.eth")
+	assert.Nil(t, err)
+	assert.Equal(t, "/ipfs/m1", l.Manifest)
+	assert.Equal(t, uint64(3), l.Epoch)
+	assert.Equal(t, []string{"h1", "h2"}, l.Hashes)
+	assert.Equal(t, []uint64{10, 20}, l.Sizes)
+}
@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"github.com/ethereum/go-ethereum/rlp"
+	dberr "github.com/syndtr/goleveldb/leveldb/errors"
+)
+
+// Manifest returns the last manifest read from an ENS name, or nil if none.
+func (s *Storage) Manifest(ensname string) (*ManifestEntry, error) {
+
+	mkey := append([]byte(prefixManifest), []byte(ensname)...)
+	mvalue, err := s.db.Get(mkey, nil)
+	if err == dberr.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var mentry ManifestEntry
+	if err = rlp.DecodeBytes(mvalue, &mentry); err != nil {
+		return nil, err
+	}
+	return &mentry, nil
+}
+
+// SetManifest sets the last manifest read from an ENS name.
+func (s *Storage) SetManifest(ensname string, mentry *ManifestEntry) error {
+
+	mkey := append([]byte(prefixManifest), []byte(ensname)...)
+	mvalue, err := rlp.EncodeToBytes(mentry)
+	if err != nil {
+		return err
+	}
+	return s.db.Put(mkey, mvalue, nil)
+}
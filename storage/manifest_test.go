@@ -0,0 +1,30 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManifest(t *testing.T) {
+	s := CreateTestDB(t)
+
+	m, err := s.Manifest("a.eth")
+	assert.Nil(t, err)
+	assert.Nil(t, m)
+
+	err = s.SetManifest("a.eth", &ManifestEntry{
+		Hash:  "/ipfs/m1",
+		Data:  []byte(`{"type":"manifest"}`),
+		Block: 100,
+		Seen:  1500000000,
+	})
+	assert.Nil(t, err)
+
+	m, err = s.Manifest("a.eth")
+	assert.Nil(t, err)
+	assert.Equal(t, "/ipfs/m1", m.Hash)
+	assert.Equal(t, `{"type":"manifest"}`, string(m.Data))
+	assert.Equal(t, uint64(100), m.Block)
+	assert.Equal(t, uint64(1500000000), m.Seen)
+}
@@ -45,6 +45,9 @@ func (s *Storage) AddMember(member string) error {
 	var mkey, mvalue []byte
 	var mentry *MemberEntry
 
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
 	if mkey, mentry, err = s.memberGet(member); err != nil {
 		return err
 	}
@@ -65,9 +68,28 @@ func (s *Storage) AddMember(member string) error {
 	return s.db.Put(mkey, mvalue, nil)
 }
 
+// UpdateMember sets the member entry in the storage.
+func (s *Storage) UpdateMember(member string, mentry *MemberEntry) error {
+
+	var err error
+
+	mkey := append([]byte(prefixMember), []byte(member)...)
+
+	var mvalue []byte
+	if mvalue, err = rlp.EncodeToBytes(mentry); err != nil {
+		return err
+	}
+
+	return s.db.Put(mkey, mvalue, nil)
+}
+
 // RemoveMember from the storage..
 func (s *Storage) RemoveMember(member string) error {
 	key := append([]byte(prefixMember), []byte(member)[:]...)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
 	_, err := s.db.Get(key, nil)
 	if err == dberr.ErrNotFound {
 		return ErrKeyNotExists
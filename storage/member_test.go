@@ -81,3 +81,18 @@ func TestGetMember(t *testing.T) {
 
 	assert.Equal(t, uint(0), m.HashCount)
 }
+
+func TestUpdateMember(t *testing.T) {
+	s := CreateTestDB(t)
+
+	err := s.AddMember("1")
+	assert.Nil(t, err)
+
+	err = s.UpdateMember("1", &MemberEntry{HashCount: 3, DataSize: 1000})
+	assert.Nil(t, err)
+
+	m, err := s.Member("1")
+	assert.Nil(t, err)
+	assert.Equal(t, uint(3), m.HashCount)
+	assert.Equal(t, uint(1000), m.DataSize)
+}
@@ -1,8 +1,33 @@
 package storage
 
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
 type HashEntry struct {
 	DataSize uint
 	Links    []string
+
+	// Epoch is the last sync where the hash was marked, it replaces the mark
+	//   flag of previous versions that is read as epoch 0 or 1
+	Epoch uint64
+	Dirty bool
+
+	// MissedSince is the unix time of the first of the consecutive syncs
+	//   where the hash was not marked, MissedSyncs the number of them
+	MissedSince uint64
+	MissedSyncs uint
+
+	// Recursive is set if the hash is pinned recursively, then DataSize is
+	//   the cumulative size of its DAG and its links have no entries
+	Recursive bool
+}
+
+// legacyHashEntry is the HashEntry stored by previous versions.
+type legacyHashEntry struct {
+	DataSize uint
+	Links    []string
 	Mark     bool
 	Dirty    bool
 }
@@ -14,6 +39,12 @@ type MemberEntry struct {
 
 type GlobalsEntry struct {
 	CurrentQuota uint
+	Epoch        uint64
+}
+
+// legacyGlobalsEntry is the GlobalsEntry stored by previous versions.
+type legacyGlobalsEntry struct {
+	CurrentQuota uint
 }
 
 type SavePointEntry struct {
@@ -22,6 +53,67 @@ type SavePointEntry struct {
 	LastLogIndex uint
 }
 
+// ProcessedBlockEntry is a block processed by the event scanner, with the
+// handled events, kept to detect chain reorganizations.
+type ProcessedBlockEntry struct {
+	Number uint64
+	Hash   common.Hash
+	Logs   []*types.LogForStorage
+}
+
+// ResolvesEntry has the IPFS hashes reached from a source (an ENS entry or a
+// pin registry) the last time it was resolved.
 type ResolvesEntry struct {
 	Entries []string
 }
+
+// ManifestEntry is the last manifest read from an ENS name, with its IPFS
+// hash, and the block and unix time when it was read.
+type ManifestEntry struct {
+	Hash  string
+	Data  []byte
+	Block uint64
+	Seen  uint64
+}
+
+// LeafEntry is a pinning manifest with only IPFS hashes, that was completely
+// collected in a sync, with all the hashes reached from it and their sizes.
+type LeafEntry struct {
+	Manifest string
+	Epoch    uint64
+	Hashes   []string
+	Sizes    []uint64
+}
+
+// QueueEntry is an IPFS object pending to be traversed, with the object that
+// links it, the quota it is charged to in the current sync and the path of
+// the manifest entry that reaches it.
+type QueueEntry struct {
+	Hash   string
+	Parent string
+	Quota  uint64
+	Path   string
+}
+
+// WhyEntry is a reference to an IPFS hash. It is either from the ENS path of
+// a manifest that pins the hash, with the root and the consortium member
+// where the path starts and the last epoch it was seen, or from the Parent
+// object that links the hash.
+type WhyEntry struct {
+	Root   string
+	Member string
+	Path   string
+	Parent string
+	Epoch  uint64
+}
+
+// FailureEntry has the consecutive failures to fetch or pin an IPFS hash,
+// the last error, the unix time of the next retry, if it failed permanently,
+// and the last epoch it was reached.
+type FailureEntry struct {
+	Failures  uint
+	LastError string
+	NextRetry uint64
+	Permanent bool
+	Epoch     uint64
+}
@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"encoding/binary"
+
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// queuePrefix returns the prefix of the traversal queue of a member, the
+// member name is ended with a zero byte that ENS names cannot contain.
+func queuePrefix(member string) []byte {
+	return []byte(prefixQueue + member + "\x00")
+}
+
+// queueKey returns the key of the queue entry of a member with sequence
+// number seq.
+func queueKey(member string, seq uint64) []byte {
+	prefix := queuePrefix(member)
+	key := make([]byte, len(prefix)+8)
+	copy(key, prefix)
+	binary.BigEndian.PutUint64(key[len(prefix):], seq)
+	return key
+}
+
+// queueMember returns the member of a queue entry key.
+func queueMember(key []byte) string {
+	return string(key[len(prefixQueue) : len(key)-9])
+}
+
+// QueuePush adds an entry at the end of the traversal queue of a member.
+func (s *Storage) QueuePush(member string, qentry *QueueEntry) error {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.queueSeq == 0 {
+		// continue after the last entry stored in any queue
+		iter := s.db.NewIterator(util.BytesPrefix([]byte(prefixQueue)), nil)
+		for iter.Next() {
+			key := iter.Key()
+			if seq := binary.BigEndian.Uint64(key[len(key)-8:]); seq > s.queueSeq {
+				s.queueSeq = seq
+			}
+		}
+		iter.Release()
+		if err := iter.Error(); err != nil {
+			return err
+		}
+	}
+
+	qvalue, err := rlp.EncodeToBytes(qentry)
+	if err != nil {
+		return err
+	}
+	s.queueSeq++
+	return s.db.Put(queueKey(member, s.queueSeq), qvalue, nil)
+}
+
+// QueuePop removes and returns the first entry of the traversal queue of a
+// member, or nil if the queue is empty.
+func (s *Storage) QueuePop(member string) (*QueueEntry, error) {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.queueHeads == nil {
+		s.queueHeads = make(map[string]uint64)
+	}
+	slice := util.BytesPrefix(queuePrefix(member))
+	if head, ok := s.queueHeads[member]; ok {
+		slice.Start = queueKey(member, head+1)
+	}
+	iter := s.db.NewIterator(slice, nil)
+	defer iter.Release()
+
+	if !iter.First() {
+		return nil, iter.Error()
+	}
+
+	var qentry QueueEntry
+	if err := rlp.DecodeBytes(iter.Value(), &qentry); err != nil {
+		return nil, err
+	}
+	key := iter.Key()
+	if err := s.db.Delete(key, nil); err != nil {
+		return nil, err
+	}
+	s.queueHeads[member] = binary.BigEndian.Uint64(key[len(key)-8:])
+	return &qentry, nil
+}
+
+// QueueMembers returns the members with entries in their traversal queues.
+func (s *Storage) QueueMembers() ([]string, error) {
+
+	iter := s.db.NewIterator(util.BytesPrefix([]byte(prefixQueue)), nil)
+	defer iter.Release()
+
+	var members []string
+	for ok := iter.First(); ok; {
+		member := queueMember(iter.Key())
+		members = append(members, member)
+		// skip the other entries of the member
+		ok = iter.Seek([]byte(prefixQueue + member + "\x01"))
+	}
+	return members, iter.Error()
+}
+
+// QueueLen returns the number of entries in all the traversal queues.
+func (s *Storage) QueueLen() (int, error) {
+
+	iter := s.db.NewIterator(util.BytesPrefix([]byte(prefixQueue)), nil)
+	defer iter.Release()
+
+	count := 0
+	for iter.Next() {
+		count++
+	}
+	return count, iter.Error()
+}
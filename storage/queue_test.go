@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueue(t *testing.T) {
+	s := CreateTestDB(t)
+
+	q, err := s.QueuePop("m1.eth")
+	assert.Nil(t, err)
+	assert.Nil(t, q)
+
+	assert.Nil(t, s.QueuePush("m1.eth", &QueueEntry{Hash: "h1", Quota: 1, Path: "p1"}))
+	assert.Nil(t, s.QueuePush("m1.eth", &QueueEntry{Hash: "h2", Parent: "h1", Quota: 1}))
+
+	count, err := s.QueueLen()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+
+	q, err = s.QueuePop("m1.eth")
+	assert.Nil(t, err)
+	assert.Equal(t, "h1", q.Hash)
+	assert.Equal(t, "p1", q.Path)
+
+	assert.Nil(t, s.QueuePush("m1.eth", &QueueEntry{Hash: "h3", Parent: "h1"}))
+
+	q, err = s.QueuePop("m1.eth")
+	assert.Nil(t, err)
+	assert.Equal(t, "h2", q.Hash)
+	assert.Equal(t, "h1", q.Parent)
+	assert.Equal(t, uint64(1), q.Quota)
+
+	q, err = s.QueuePop("m1.eth")
+	assert.Nil(t, err)
+	assert.Equal(t, "h3", q.Hash)
+
+	q, err = s.QueuePop("m1.eth")
+	assert.Nil(t, err)
+	assert.Nil(t, q)
+}
+
+func TestQueueMembers(t *testing.T) {
+	s := CreateTestDB(t)
+
+	assert.Nil(t, s.QueuePush("m2.eth", &QueueEntry{Hash: "h1"}))
+	assert.Nil(t, s.QueuePush("", &QueueEntry{Hash: "h2"}))
+	assert.Nil(t, s.QueuePush("m1.eth", &QueueEntry{Hash: "h3"}))
+	assert.Nil(t, s.QueuePush("m2.eth", &QueueEntry{Hash: "h4"}))
+	assert.Nil(t, s.QueuePush("m1.eth.x", &QueueEntry{Hash: "h5"}))
+
+	members, err := s.QueueMembers()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"", "m1.eth", "m1.eth.x", "m2.eth"}, members)
+
+	// the queues are independent
+	q, err := s.QueuePop("m2.eth")
+	assert.Nil(t, err)
+	assert.Equal(t, "h1", q.Hash)
+	q, err = s.QueuePop("m1.eth")
+	assert.Nil(t, err)
+	assert.Equal(t, "h3", q.Hash)
+	q, err = s.QueuePop("m1.eth")
+	assert.Nil(t, err)
+	assert.Nil(t, q)
+
+	// a new storage continues after the last entry of any queue
+	s.queueSeq = 0
+	assert.Nil(t, s.QueuePush("m2.eth", &QueueEntry{Hash: "h6"}))
+	q, err = s.QueuePop("m2.eth")
+	assert.Nil(t, err)
+	assert.Equal(t, "h4", q.Hash)
+	q, err = s.QueuePop("m2.eth")
+	assert.Nil(t, err)
+	assert.Equal(t, "h6", q.Hash)
+}
+
+func TestQueueDrain(t *testing.T) {
+	s := CreateTestDB(t)
+
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, s.QueuePush("m1.eth", &QueueEntry{Hash: fmt.Sprintf("h%v", i)}))
+	}
+	for i := 0; i < 100; i++ {
+		q, err := s.QueuePop("m1.eth")
+		assert.Nil(t, err)
+		assert.Equal(t, fmt.Sprintf("h%v", i), q.Hash)
+		assert.Equal(t, uint64(i+1), s.queueHeads["m1.eth"])
+	}
+
+	q, err := s.QueuePop("m1.eth")
+	assert.Nil(t, err)
+	assert.Nil(t, q)
+
+	// the entries pushed after draining the queue are popped
+	assert.Nil(t, s.QueuePush("m1.eth", &QueueEntry{Hash: "h100"}))
+	q, err = s.QueuePop("m1.eth")
+	assert.Nil(t, err)
+	assert.Equal(t, "h100", q.Hash)
+}
@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"github.com/ethereum/go-ethereum/rlp"
+	dberr "github.com/syndtr/goleveldb/leveldb/errors"
+)
+
+// Resolves returns the last successful resolution of a source, or nil if
+// the source was never resolved.
+func (s *Storage) Resolves(source string) (*ResolvesEntry, error) {
+
+	rkey := append([]byte(prefixResolves), []byte(source)...)
+	rvalue, err := s.db.Get(rkey, nil)
+	if err == dberr.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var rentry ResolvesEntry
+	if err = rlp.DecodeBytes(rvalue, &rentry); err != nil {
+		return nil, err
+	}
+	return &rentry, nil
+}
+
+// SetResolves sets the last successful resolution of a source.
+func (s *Storage) SetResolves(source string, rentry *ResolvesEntry) error {
+
+	rkey := append([]byte(prefixResolves), []byte(source)...)
+	rvalue, err := rlp.EncodeToBytes(rentry)
+	if err != nil {
+		return err
+	}
+	return s.db.Put(rkey, rvalue, nil)
+}
@@ -0,0 +1,24 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolves(t *testing.T) {
+	s := CreateTestDB(t)
+
+	r, err := s.Resolves("consortiumManifest[a.eth]")
+	assert.Nil(t, err)
+	assert.Nil(t, r)
+
+	err = s.SetResolves("consortiumManifest[a.eth]", &ResolvesEntry{
+		Entries: []string{"h1", "h2"},
+	})
+	assert.Nil(t, err)
+
+	r, err = s.Resolves("consortiumManifest[a.eth]")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"h1", "h2"}, r.Entries)
+}
@@ -0,0 +1,199 @@
+package storage
+
+import (
+	"math"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ipfsconsortium/go-ipfsc/eth"
+	log "github.com/sirupsen/logrus"
+	dberr "github.com/syndtr/goleveldb/leveldb/errors"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// SavePoint is an eth.SavePoint persisted in the storage, so the event
+// scanner restarts exactly where it stopped.
+type SavePoint struct {
+	storage *Storage
+}
+
+// SavePoint returns the persisted savepoint of the storage.
+func (s *Storage) SavePoint() *SavePoint {
+	return &SavePoint{s}
+}
+
+// Load the last processed log.
+func (p *SavePoint) Load() (lastBlock uint64, lastTxIndex, lastLogIndex uint, err error) {
+	entry, err := p.storage.SavePointEntry()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if entry == nil {
+		return 0, 0, 0, nil
+	}
+	return entry.LastBlock, entry.LastTxIndex, entry.LastLogIndex, nil
+}
+
+// Save the last processed log.
+func (p *SavePoint) Save(logevent *types.Log) error {
+	return p.storage.SetSavePointEntry(SavePointEntry{
+		LastBlock:    logevent.BlockNumber,
+		LastTxIndex:  logevent.TxIndex,
+		LastLogIndex: logevent.Index,
+	})
+}
+
+// SaveBlock saves the end of the block as the last processed log.
+func (p *SavePoint) SaveBlock(block uint64) error {
+	log.WithField("block", block).Debug("DB saved block savepoint")
+	return p.storage.SetSavePointEntry(blockSavePoint(block + 1))
+}
+
+// LoadHistory loads the recent blocks processed by the scanner.
+func (p *SavePoint) LoadHistory() ([]eth.ProcessedBlock, error) {
+
+	value, err := p.storage.db.Get([]byte(prefixHistory), nil)
+	if err == dberr.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var entries []ProcessedBlockEntry
+	if err = rlp.DecodeBytes(value, &entries); err != nil {
+		return nil, err
+	}
+	history := make([]eth.ProcessedBlock, len(entries))
+	for i, entry := range entries {
+		history[i] = eth.ProcessedBlock{Number: entry.Number, Hash: entry.Hash}
+		for _, logevent := range entry.Logs {
+			history[i].Logs = append(history[i].Logs, (*types.Log)(logevent))
+		}
+	}
+	return history, nil
+}
+
+// SaveHistory saves the recent blocks processed by the scanner.
+func (p *SavePoint) SaveHistory(history []eth.ProcessedBlock) error {
+
+	entries := make([]ProcessedBlockEntry, len(history))
+	for i, block := range history {
+		entries[i] = ProcessedBlockEntry{Number: block.Number, Hash: block.Hash}
+		for _, logevent := range block.Logs {
+			entries[i].Logs = append(entries[i].Logs, (*types.LogForStorage)(logevent))
+		}
+	}
+	value, err := rlp.EncodeToBytes(entries)
+	if err != nil {
+		return err
+	}
+	return p.storage.db.Put([]byte(prefixHistory), value, nil)
+}
+
+// SkipTx returns if the transaction must not be processed.
+func (p *SavePoint) SkipTx(txid common.Hash) (bool, error) {
+	_, err := p.storage.db.Get(append([]byte(prefixSkipTx), txid[:]...), nil)
+	if err == dberr.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// SavePointEntry gets the savepoint, nil if it is not defined.
+func (s *Storage) SavePointEntry() (*SavePointEntry, error) {
+
+	value, err := s.db.Get([]byte(prefixSavePoint), nil)
+	if err == dberr.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var entry SavePointEntry
+	if err = rlp.DecodeBytes(value, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// SetSavePointEntry in the storage.
+func (s *Storage) SetSavePointEntry(entry SavePointEntry) error {
+
+	value, err := rlp.EncodeToBytes(entry)
+	if err != nil {
+		return err
+	}
+	return s.db.Put([]byte(prefixSavePoint), value, nil)
+}
+
+// blockSavePoint returns the savepoint that starts scanning at the beginning
+// of the block, by marking all the transactions of the previous block as
+// processed.
+func blockSavePoint(block uint64) SavePointEntry {
+	entry := SavePointEntry{}
+	if block > 0 {
+		entry.LastBlock = block - 1
+		entry.LastTxIndex = math.MaxUint32
+	}
+	return entry
+}
+
+// MoveSavePoint sets the savepoint so the scanning starts at the beginning
+// of the block. The history of processed blocks is removed, since the
+// scanning does not follow it anymore.
+func (s *Storage) MoveSavePoint(block uint64) error {
+
+	log.WithField("block", block).Debug("DB moved savepoint")
+
+	if err := s.db.Delete([]byte(prefixHistory), nil); err != nil {
+		return err
+	}
+	return s.SetSavePointEntry(blockSavePoint(block))
+}
+
+// ResetSavePoint removes the savepoint and the history of processed blocks
+// from the storage.
+func (s *Storage) ResetSavePoint() error {
+	log.Debug("DB removed savepoint")
+	if err := s.db.Delete([]byte(prefixHistory), nil); err != nil {
+		return err
+	}
+	return s.db.Delete([]byte(prefixSavePoint), nil)
+}
+
+// AddSkipTx adds a transaction to be skipped by the scanner.
+func (s *Storage) AddSkipTx(txid common.Hash) error {
+	return s.db.Put(append([]byte(prefixSkipTx), txid[:]...), []byte{}, nil)
+}
+
+// RemoveSkipTx removes a transaction to be skipped by the scanner.
+func (s *Storage) RemoveSkipTx(txid common.Hash) error {
+	key := append([]byte(prefixSkipTx), txid[:]...)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	_, err := s.db.Get(key, nil)
+	if err == dberr.ErrNotFound {
+		return ErrKeyNotExists
+	}
+	if err != nil {
+		return err
+	}
+	return s.db.Delete(key, nil)
+}
+
+// SkipTxs returns the transactions to be skipped by the scanner.
+func (s *Storage) SkipTxs() ([]common.Hash, error) {
+
+	txids := []common.Hash{}
+
+	iter := s.db.NewIterator(util.BytesPrefix([]byte(prefixSkipTx)), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		txids = append(txids, common.BytesToHash(iter.Key()[len(prefixSkipTx):]))
+	}
+	return txids, iter.Error()
+}
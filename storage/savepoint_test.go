@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"math"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ipfsconsortium/go-ipfsc/eth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSavePoint(t *testing.T) {
+	s := CreateTestDB(t)
+	p := s.SavePoint()
+
+	entry, err := s.SavePointEntry()
+	assert.Nil(t, err)
+	assert.Nil(t, entry)
+
+	err = p.Save(&types.Log{BlockNumber: 100, TxIndex: 2, Index: 3})
+	assert.Nil(t, err)
+
+	block, txindex, logindex, err := p.Load()
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(100), block)
+	assert.Equal(t, uint(2), txindex)
+	assert.Equal(t, uint(3), logindex)
+
+	err = s.MoveSavePoint(50)
+	assert.Nil(t, err)
+	block, txindex, logindex, err = p.Load()
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(49), block)
+	assert.Equal(t, uint(math.MaxUint32), txindex)
+	assert.Equal(t, uint(0), logindex)
+
+	err = s.ResetSavePoint()
+	assert.Nil(t, err)
+	entry, err = s.SavePointEntry()
+	assert.Nil(t, err)
+	assert.Nil(t, entry)
+}
+
+func TestSkipTx(t *testing.T) {
+	s := CreateTestDB(t)
+	p := s.SavePoint()
+
+	tx1 := common.HexToHash("0x01")
+	tx2 := common.HexToHash("0x02")
+
+	assert.Nil(t, s.AddSkipTx(tx1))
+
+	skip, err := p.SkipTx(tx1)
+	assert.Nil(t, err)
+	assert.True(t, skip)
+
+	skip, err = p.SkipTx(tx2)
+	assert.Nil(t, err)
+	assert.False(t, skip)
+
+	txids, err := s.SkipTxs()
+	assert.Nil(t, err)
+	assert.Equal(t, []common.Hash{tx1}, txids)
+
+	assert.Nil(t, s.RemoveSkipTx(tx1))
+	assert.Equal(t, ErrKeyNotExists, s.RemoveSkipTx(tx1))
+
+	skip, err = p.SkipTx(tx1)
+	assert.Nil(t, err)
+	assert.False(t, skip)
+}
+
+func TestSavePointSaveBlock(t *testing.T) {
+	s := CreateTestDB(t)
+	p := s.SavePoint()
+
+	err := p.Save(&types.Log{BlockNumber: 100, TxIndex: 2, Index: 3})
+	assert.Nil(t, err)
+
+	err = p.SaveBlock(90)
+	assert.Nil(t, err)
+	block, txindex, _, err := p.Load()
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(90), block)
+	assert.Equal(t, uint(math.MaxUint32), txindex)
+}
+
+func TestSavePointHistory(t *testing.T) {
+	s := CreateTestDB(t)
+	p := s.SavePoint()
+
+	history, err := p.LoadHistory()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(history))
+
+	logevent := &types.Log{
+		Address:     common.HexToAddress("0x01"),
+		Topics:      []common.Hash{common.HexToHash("0x02")},
+		Data:        []byte{3},
+		BlockNumber: 100,
+		TxHash:      common.HexToHash("0x04"),
+		TxIndex:     5,
+		BlockHash:   common.HexToHash("0x06"),
+		Index:       7,
+	}
+	saved := []eth.ProcessedBlock{
+		{Number: 99, Hash: common.HexToHash("0x99")},
+		{Number: 100, Hash: common.HexToHash("0x06"), Logs: []*types.Log{logevent}},
+	}
+	assert.Nil(t, p.SaveHistory(saved))
+
+	history, err = p.LoadHistory()
+	assert.Nil(t, err)
+	assert.Equal(t, saved, history)
+
+	// saving a block keeps the history, moving the savepoint removes it
+	assert.Nil(t, p.SaveBlock(100))
+	history, err = p.LoadHistory()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(history))
+
+	assert.Nil(t, s.MoveSavePoint(50))
+	history, err = p.LoadHistory()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(history))
+}
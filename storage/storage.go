@@ -5,13 +5,24 @@ import (
 	"sync"
 
 	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
 const (
-	prefixHash     = "H"
-	prefixMember   = "C"
-	prefixGlobals  = "G"
-	prefixResolves = "R"
+	prefixHash      = "H"
+	prefixFailure   = "F"
+	prefixMember    = "C"
+	prefixGlobals   = "G"
+	prefixResolves  = "R"
+	prefixManifest  = "M"
+	prefixLeaf      = "L"
+	prefixQueue     = "Q"
+	prefixWhy       = "W"
+	prefixSavePoint = "S"
+	prefixSkipTx    = "X"
+	prefixHistory   = "B"
 )
 
 var (
@@ -20,10 +31,29 @@ var (
 	ErrInconsistentSize = errors.New("inconsistent db and IPFS datasize")
 )
 
+// kvstore are the db operations used by the storage, implemented both by
+// the db and by its transactions.
+type kvstore interface {
+	Get(key []byte, ro *opt.ReadOptions) ([]byte, error)
+	Put(key, value []byte, wo *opt.WriteOptions) error
+	Delete(key []byte, wo *opt.WriteOptions) error
+	NewIterator(slice *util.Range, ro *opt.ReadOptions) iterator.Iterator
+}
+
 // Storage manages the application state
 type Storage struct {
+	// mutex serializes the operations that read and then write entries, so
+	// they can be done while the db is updated from other goroutines
 	mutex *sync.Mutex
-	db    *leveldb.DB
+	db    kvstore
+
+	// queueSeq is the sequence number of the last traversal queue entry
+	queueSeq uint64
+
+	// queueHeads are the sequence numbers of the last entries popped from
+	//   the traversal queue of each member, to seek the next entry after
+	//   them instead of iterating through the deleted ones
+	queueHeads map[string]uint64
 }
 
 // New creates a new storage path.
@@ -37,3 +67,12 @@ func New(path string) (*Storage, error) {
 		mutex: &sync.Mutex{},
 	}, nil
 }
+
+// Close closes the db, flushing its writes. Dry run storages are discarded
+// instead.
+func (s *Storage) Close() error {
+	if db, ok := s.db.(*leveldb.DB); ok {
+		return db.Close()
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// whyKey returns the key of the reference to hash from a referrer, that is
+// an ENS path or a linking object.
+func whyKey(hash, referrer string) []byte {
+	return []byte(prefixWhy + hash + "\x00" + referrer)
+}
+
+// AddWhy sets a reference to an IPFS hash.
+func (s *Storage) AddWhy(hash string, wentry *WhyEntry) error {
+
+	referrer := wentry.Parent
+	if referrer == "" {
+		referrer = wentry.Path
+	}
+	wvalue, err := rlp.EncodeToBytes(wentry)
+	if err != nil {
+		return err
+	}
+	return s.db.Put(whyKey(hash, referrer), wvalue, nil)
+}
+
+// Why returns the references to an IPFS hash.
+func (s *Storage) Why(hash string) ([]*WhyEntry, error) {
+
+	iter := s.db.NewIterator(util.BytesPrefix(whyKey(hash, "")), nil)
+	defer iter.Release()
+
+	var wentries []*WhyEntry
+	for iter.Next() {
+		var wentry WhyEntry
+		if err := rlp.DecodeBytes(iter.Value(), &wentry); err != nil {
+			return nil, err
+		}
+		wentries = append(wentries, &wentry)
+	}
+	return wentries, iter.Error()
+}
+
+// TouchWhy sets the epoch of the ENS paths that reference an IPFS hash.
+func (s *Storage) TouchWhy(hash string, epoch uint64) error {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	wentries, err := s.Why(hash)
+	if err != nil {
+		return err
+	}
+	for _, wentry := range wentries {
+		if wentry.Parent != "" || wentry.Epoch == epoch {
+			continue
+		}
+		wentry.Epoch = epoch
+		if err := s.AddWhy(hash, wentry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteWhy removes the reference to an IPFS hash from an object.
+func (s *Storage) DeleteWhy(hash, parent string) error {
+	return s.db.Delete(whyKey(hash, parent), nil)
+}
+
+// PurgeWhy removes the references from ENS paths not seen since epoch.
+func (s *Storage) PurgeWhy(epoch uint64) error {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	iter := s.db.NewIterator(util.BytesPrefix([]byte(prefixWhy)), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		var wentry WhyEntry
+		if err := rlp.DecodeBytes(iter.Value(), &wentry); err != nil {
+			return err
+		}
+		if wentry.Parent == "" && wentry.Epoch < epoch {
+			if err := s.db.Delete(iter.Key(), nil); err != nil {
+				return err
+			}
+		}
+	}
+	return iter.Error()
+}
@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWhy(t *testing.T) {
+	s := CreateTestDB(t)
+
+	assert.Nil(t, s.AddWhy("h1", &WhyEntry{Root: "c.eth", Member: "m.eth", Path: "/m.eth(#0)", Epoch: 2}))
+	assert.Nil(t, s.AddWhy("h11", &WhyEntry{Parent: "h1"}))
+	assert.Nil(t, s.AddWhy("h1", &WhyEntry{Root: "c.eth", Path: "/n.eth(#0)", Epoch: 2}))
+
+	wentries, err := s.Why("h1")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(wentries))
+
+	wentries, err = s.Why("h11")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(wentries))
+	assert.Equal(t, "h1", wentries[0].Parent)
+
+	assert.Nil(t, s.TouchWhy("h1", 3))
+	assert.Nil(t, s.AddWhy("h1", &WhyEntry{Root: "c.eth", Path: "/o.eth(#0)", Epoch: 2}))
+	assert.Nil(t, s.PurgeWhy(3))
+
+	wentries, err = s.Why("h1")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(wentries))
+	for _, wentry := range wentries {
+		assert.Equal(t, uint64(3), wentry.Epoch)
+	}
+
+	// references from objects are not purged
+	wentries, err = s.Why("h11")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(wentries))
+
+	assert.Nil(t, s.DeleteWhy("h11", "h1"))
+	wentries, err = s.Why("h11")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(wentries))
+}